@@ -4,18 +4,34 @@ import (
 	"sync"
 
 	"github.com/waynezhang/foto/internal/constants"
+	"github.com/waynezhang/foto/internal/images"
 )
 
 type Cache interface {
 	Migrate()
-	AddImage(src string, width int, height int, compressQuality int, file string)
-	CachedImage(src string, width int, height int, compressQuality int) *string
+	AddImage(src string, width int, height int, compressQuality int, format images.Format, file string)
+	CachedImage(src string, width int, height int, compressQuality int, format images.Format) *string
+	// SHA-256 of `src`, hashed only when its size or modification time changed unless `Verify`
+	Checksum(src string) (*string, error)
+	// Record of `src` if it's unchanged since it was added, nil otherwise
+	IndexRecord(src string) *IndexRecord
+	AddIndexRecord(src string, record IndexRecord)
+	// Writes index records and checksums added since the last save, and lookups of cached images
+	Save() error
+	Stats() (Stats, error)
+	// Removes the least recently used images until the cached images take at most `maxBytes`
+	PruneToSize(maxBytes int64) (PruneResult, error)
+	// Forgets sources `keep` returns false for and removes their cached images
+	PruneSources(keep func(src string) bool) (PruneResult, error)
 	Clear()
 }
 
 var (
 	once     sync.Once
 	instance Cache
+
+	// Hash source files even when their size and modification time are unchanged. Set by `--verify`.
+	Verify bool
 )
 
 func Shared() Cache {
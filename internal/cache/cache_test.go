@@ -5,10 +5,13 @@ import (
 	"os"
 	"path/filepath"
 	"testing"
+	"time"
 
+	cp "github.com/otiai10/copy"
 	"github.com/stretchr/testify/assert"
 	"github.com/waynezhang/foto/internal/constants"
 	"github.com/waynezhang/foto/internal/files"
+	"github.com/waynezhang/foto/internal/images"
 	"github.com/waynezhang/foto/internal/testdata"
 )
 
@@ -21,23 +24,23 @@ func TestFolderCache(t *testing.T) {
 
 	assert.Equal(t, dirName, cache.directoryName)
 
-	img := cache.CachedImage(testdata.Testfile, 640, 480, testdata.CompressQuality)
+	img := cache.CachedImage(testdata.Testfile, 640, 480, testdata.CompressQuality, images.FormatJPEG)
 	assert.Nil(t, img)
 
-	cache.AddImage(testdata.Testfile, 640, 480, testdata.CompressQuality, testdata.ThumbnailFile)
-	img = cache.CachedImage(testdata.Testfile, 640, 480, testdata.CompressQuality)
-	expectedPath := fmt.Sprintf("%s/%s-640-480-%d", dirName, testdata.ExpectedChecksum, testdata.CompressQuality)
+	cache.AddImage(testdata.Testfile, 640, 480, testdata.CompressQuality, images.FormatJPEG, testdata.ThumbnailFile)
+	img = cache.CachedImage(testdata.Testfile, 640, 480, testdata.CompressQuality, images.FormatJPEG)
+	expectedPath := fmt.Sprintf("%s/%s-640-480-%d-jpeg", dirName, testdata.ExpectedChecksum, testdata.CompressQuality)
 	assert.Equal(t, expectedPath, *img)
 
 	// no file for different compressQuality
-	assert.Nil(t, cache.CachedImage(testdata.Testfile, 640, 480, testdata.CompressQualityHQ))
+	assert.Nil(t, cache.CachedImage(testdata.Testfile, 640, 480, testdata.CompressQualityHQ, images.FormatJPEG))
 
 	resizedChecksum, _ := files.Checksum(expectedPath)
 	assert.Equal(t, testdata.ExpectedThubmnailChecksum, *resizedChecksum)
 
 	// no failure on invalid file
-	cache.AddImage("nonexisting-file.jpg", 640, 480, testdata.CompressQuality, testdata.ThumbnailFile)
-	img = cache.CachedImage("nonexisting-file.jpg", 640, 480, testdata.CompressQuality)
+	cache.AddImage("nonexisting-file.jpg", 640, 480, testdata.CompressQuality, images.FormatJPEG, testdata.ThumbnailFile)
+	img = cache.CachedImage("nonexisting-file.jpg", 640, 480, testdata.CompressQuality, images.FormatJPEG)
 	assert.Nil(t, img)
 
 	cache.Clear()
@@ -55,8 +58,11 @@ func TestShared(t *testing.T) {
 
 func TestImagePath(t *testing.T) {
 	cache := NewFolderCache("some-path").(folderCache)
-	path := cache.imagePath("some-checksum", 200, 150, 75)
-	assert.Equal(t, "some-path/some-checksum-200-150-75", path)
+	path := cache.imagePath("some-checksum", 200, 150, 75, images.FormatJPEG)
+	assert.Equal(t, "some-path/some-checksum-200-150-75-jpeg", path)
+
+	path = cache.imagePath("some-checksum", 200, 150, 75, images.FormatWebP)
+	assert.Equal(t, "some-path/some-checksum-200-150-75-webp", path)
 }
 
 // no version
@@ -68,13 +74,13 @@ func TestVersioning1(t *testing.T) {
 	cache := NewFolderCache(dirName)
 	assert.Equal(t, "", readVersion(dirName))
 
-	cache.AddImage(testdata.Testfile, 640, 480, testdata.CompressQuality, testdata.ThumbnailFile)
-	assert.NotNil(t, cache.CachedImage(testdata.Testfile, 640, 480, testdata.CompressQuality))
+	cache.AddImage(testdata.Testfile, 640, 480, testdata.CompressQuality, images.FormatJPEG, testdata.ThumbnailFile)
+	assert.NotNil(t, cache.CachedImage(testdata.Testfile, 640, 480, testdata.CompressQuality, images.FormatJPEG))
 
 	cache.Migrate()
 
 	assert.Equal(t, constants.CacheVersion, readVersion(dirName))
-	assert.Nil(t, cache.CachedImage(testdata.Testfile, 640, 480, testdata.CompressQuality))
+	assert.Nil(t, cache.CachedImage(testdata.Testfile, 640, 480, testdata.CompressQuality, images.FormatJPEG))
 }
 
 // upgrade
@@ -88,13 +94,13 @@ func TestVersioning2(t *testing.T) {
 	writeVersion(dirName, "0")
 	assert.Equal(t, "0", readVersion(dirName))
 
-	cache.AddImage(testdata.Testfile, 640, 480, testdata.CompressQuality, testdata.ThumbnailFile)
-	assert.NotNil(t, cache.CachedImage(testdata.Testfile, 640, 480, testdata.CompressQuality))
+	cache.AddImage(testdata.Testfile, 640, 480, testdata.CompressQuality, images.FormatJPEG, testdata.ThumbnailFile)
+	assert.NotNil(t, cache.CachedImage(testdata.Testfile, 640, 480, testdata.CompressQuality, images.FormatJPEG))
 
 	cache.Migrate()
 
 	assert.Equal(t, constants.CacheVersion, readVersion(dirName))
-	assert.Nil(t, cache.CachedImage(testdata.Testfile, 640, 480, testdata.CompressQuality))
+	assert.Nil(t, cache.CachedImage(testdata.Testfile, 640, 480, testdata.CompressQuality, images.FormatJPEG))
 }
 
 // same version
@@ -108,13 +114,13 @@ func TestVersioning3(t *testing.T) {
 	writeVersion(dirName, constants.CacheVersion)
 	assert.Equal(t, constants.CacheVersion, readVersion(dirName))
 
-	cache.AddImage(testdata.Testfile, 640, 480, testdata.CompressQuality, testdata.ThumbnailFile)
-	assert.NotNil(t, cache.CachedImage(testdata.Testfile, 640, 480, testdata.CompressQuality))
+	cache.AddImage(testdata.Testfile, 640, 480, testdata.CompressQuality, images.FormatJPEG, testdata.ThumbnailFile)
+	assert.NotNil(t, cache.CachedImage(testdata.Testfile, 640, 480, testdata.CompressQuality, images.FormatJPEG))
 
 	cache.Migrate()
 
 	assert.Equal(t, constants.CacheVersion, readVersion(dirName))
-	assert.NotNil(t, cache.CachedImage(testdata.Testfile, 640, 480, testdata.CompressQuality))
+	assert.NotNil(t, cache.CachedImage(testdata.Testfile, 640, 480, testdata.CompressQuality, images.FormatJPEG))
 }
 
 func readVersion(dirName string) string {
@@ -125,3 +131,232 @@ func readVersion(dirName string) string {
 func writeVersion(dirName string, version string) {
 	files.WriteDataToFile([]byte(version), filepath.Join(dirName, "version"))
 }
+
+func TestIndexRecord(t *testing.T) {
+	dirName := t.TempDir()
+	src := filepath.Join(t.TempDir(), "photo.jpg")
+	_ = cp.Copy(testdata.MetadataTestFile, src)
+
+	cache := NewFolderCache(dirName)
+	assert.Nil(t, cache.IndexRecord(src))
+
+	meta, _ := images.GetMetadata(src)
+	cache.AddIndexRecord(src, IndexRecord{ImageSize: images.ImageSize{Width: 640, Height: 480}, Metadata: *meta})
+	assert.Nil(t, cache.Save())
+	assert.FileExists(t, filepath.Join(dirName, indexFileName))
+
+	// Loaded from the index file
+	record := NewFolderCache(dirName).IndexRecord(src)
+	assert.NotNil(t, record)
+	assert.Equal(t, images.ImageSize{Width: 640, Height: 480}, record.ImageSize)
+	assert.Equal(t, meta.EXIF, record.Metadata.EXIF)
+	assert.True(t, meta.Info.CaptureTime.Equal(record.Metadata.Info.CaptureTime))
+
+	// Changed photo
+	later := time.Now().Add(time.Hour)
+	_ = os.Chtimes(src, later, later)
+	assert.Nil(t, NewFolderCache(dirName).IndexRecord(src))
+
+	assert.Nil(t, NewFolderCache("nonexisting-dir").IndexRecord("nonexisting-file.jpg"))
+}
+
+func TestIndexRecordSidecar(t *testing.T) {
+	src := filepath.Join(t.TempDir(), "photo.jpg")
+	_ = cp.Copy(testdata.Testfile, src)
+
+	cache := NewFolderCache(t.TempDir())
+	cache.AddIndexRecord(src, IndexRecord{})
+	assert.NotNil(t, cache.IndexRecord(src))
+
+	// A new sidecar changes the metadata
+	_ = os.WriteFile(src+".xmp", []byte(""), 0644)
+	assert.Nil(t, cache.IndexRecord(src))
+}
+
+func TestIndexRecordVersion(t *testing.T) {
+	dirName := t.TempDir()
+	files.WriteDataToFile(
+		[]byte(fmt.Sprintf(`{"Version":"0","Records":{"%s":{}}}`, absolutePath(testdata.Testfile))),
+		filepath.Join(dirName, indexFileName),
+	)
+
+	cache := NewFolderCache(dirName).(folderCache)
+	_, ok := cache.index.get(testdata.Testfile)
+	assert.False(t, ok)
+
+	cache.AddIndexRecord(testdata.Testfile, IndexRecord{})
+	cache.Clear()
+	assert.Nil(t, cache.IndexRecord(testdata.Testfile))
+}
+
+func useVerify(t *testing.T) {
+	Verify = true
+	t.Cleanup(func() { Verify = false })
+}
+
+func TestChecksum(t *testing.T) {
+	dirName := t.TempDir()
+	cache := NewFolderCache(dirName).(folderCache)
+
+	checksum, err := cache.Checksum(testdata.Testfile)
+	assert.Nil(t, err)
+	assert.Equal(t, testdata.ExpectedChecksum, *checksum)
+	assert.Nil(t, cache.Save())
+
+	// Memoized by size and modification time, across runs
+	info, _ := os.Stat(testdata.Testfile)
+	cache = NewFolderCache(dirName).(folderCache)
+	cache.index.setChecksum(testdata.Testfile, checksumEntry{Size: info.Size(), ModTime: info.ModTime(), Checksum: "memo"})
+	cache.index.verified = map[string]bool{}
+	checksum, _ = cache.Checksum(testdata.Testfile)
+	assert.Equal(t, "memo", *checksum)
+
+	// Hashed once with --verify
+	useVerify(t)
+	checksum, _ = cache.Checksum(testdata.Testfile)
+	assert.Equal(t, testdata.ExpectedChecksum, *checksum)
+
+	_, err = cache.Checksum("nonexisting-file.jpg")
+	assert.True(t, os.IsNotExist(err))
+}
+
+func TestChecksumChangedFile(t *testing.T) {
+	src := filepath.Join(t.TempDir(), "photo.jpg")
+	_ = cp.Copy(testdata.Testfile, src)
+
+	cache := NewFolderCache(t.TempDir())
+	first, _ := cache.Checksum(src)
+
+	_ = os.WriteFile(src, []byte("changed"), 0644)
+	second, _ := cache.Checksum(src)
+	assert.NotEqual(t, *first, *second)
+}
+
+func TestIndexRecordVerify(t *testing.T) {
+	src := filepath.Join(t.TempDir(), "photo.jpg")
+	_ = cp.Copy(testdata.Testfile, src)
+	info, _ := os.Stat(src)
+
+	dirName := t.TempDir()
+	cache := NewFolderCache(dirName)
+	_, _ = cache.Checksum(src)
+	cache.AddIndexRecord(src, IndexRecord{})
+	assert.Nil(t, cache.Save())
+
+	// Same size and modification time with different content
+	data, _ := os.ReadFile(src)
+	data[len(data)-3] ^= 0xff
+	_ = os.WriteFile(src, data, 0644)
+	_ = os.Chtimes(src, info.ModTime(), info.ModTime())
+
+	assert.NotNil(t, NewFolderCache(dirName).IndexRecord(src))
+
+	useVerify(t)
+	assert.Nil(t, NewFolderCache(dirName).IndexRecord(src))
+}
+
+// Adds a cached image of `size` bytes for a source with `checksum`, last used at `accessTime`
+func addEntry(t *testing.T, dirName string, checksum string, size int, accessTime time.Time) string {
+	path := filepath.Join(dirName, fmt.Sprintf("%064s-640-480-75-jpeg", checksum))
+	assert.Nil(t, os.WriteFile(path, make([]byte, size), 0644))
+	_ = os.Chtimes(path, accessTime, accessTime)
+	return path
+}
+
+func TestStats(t *testing.T) {
+	dirName := t.TempDir()
+	cache := NewFolderCache(dirName).(folderCache)
+	cache.Migrate()
+
+	stats, err := cache.Stats()
+	assert.Nil(t, err)
+	assert.Equal(t, Stats{}, stats)
+
+	cache.AddImage(testdata.Testfile, 640, 480, testdata.CompressQuality, images.FormatJPEG, testdata.ThumbnailFile)
+	assert.NotNil(t, cache.CachedImage(testdata.Testfile, 640, 480, testdata.CompressQuality, images.FormatJPEG))
+	assert.Nil(t, cache.CachedImage(testdata.Testfile, 320, 240, testdata.CompressQuality, images.FormatJPEG))
+	assert.Nil(t, cache.CachedImage(testdata.Testfile, 160, 120, testdata.CompressQuality, images.FormatJPEG))
+	assert.Nil(t, cache.Save())
+
+	info, _ := os.Stat(testdata.ThumbnailFile)
+	stats, err = NewFolderCache(dirName).Stats()
+	assert.Nil(t, err)
+	assert.Equal(t, 1, stats.Entries)
+	assert.Equal(t, info.Size(), stats.Bytes)
+	assert.Equal(t, int64(1), stats.LastExport.Hits)
+	assert.Equal(t, int64(2), stats.LastExport.Misses)
+	assert.InDelta(t, 1.0/3, stats.LastExport.HitRate(), 0.001)
+
+	stats, err = NewFolderCache("nonexisting-dir").Stats()
+	assert.Nil(t, err)
+	assert.Equal(t, 0, stats.Entries)
+}
+
+func TestPruneToSize(t *testing.T) {
+	dirName := t.TempDir()
+	now := time.Now()
+	oldest := addEntry(t, dirName, "a", 100, now.Add(-3*time.Hour))
+	old := addEntry(t, dirName, "b", 100, now.Add(-2*time.Hour))
+	recent := addEntry(t, dirName, "c", 100, now.Add(-time.Hour))
+	writeVersion(dirName, constants.CacheVersion)
+
+	cache := NewFolderCache(dirName)
+	result, err := cache.PruneToSize(250)
+	assert.Nil(t, err)
+	assert.Equal(t, PruneResult{Entries: 1, Bytes: 100}, result)
+	assert.NoFileExists(t, oldest)
+	assert.FileExists(t, old)
+
+	result, _ = cache.PruneToSize(0)
+	assert.Equal(t, 2, result.Entries)
+	assert.NoFileExists(t, recent)
+	assert.Equal(t, constants.CacheVersion, readVersion(dirName))
+}
+
+func TestPruneToSizeAccess(t *testing.T) {
+	dirName := t.TempDir()
+	cache := NewFolderCache(dirName)
+	cache.AddImage(testdata.Testfile, 640, 480, testdata.CompressQuality, images.FormatJPEG, testdata.ThumbnailFile)
+	path := *cache.CachedImage(testdata.Testfile, 640, 480, testdata.CompressQuality, images.FormatJPEG)
+	old := addEntry(t, dirName, "a", 100, time.Now().Add(-time.Minute))
+
+	// Looked up after the other image was used
+	past := time.Now().Add(-time.Hour)
+	_ = os.Chtimes(path, past, past)
+	cache.CachedImage(testdata.Testfile, 640, 480, testdata.CompressQuality, images.FormatJPEG)
+
+	info, _ := os.Stat(path)
+	_, _ = cache.PruneToSize(info.Size())
+	assert.FileExists(t, path)
+	assert.NoFileExists(t, old)
+}
+
+func TestPruneSources(t *testing.T) {
+	dirName := t.TempDir()
+	tmp := t.TempDir()
+	kept := filepath.Join(tmp, "kept.jpg")
+	removed := filepath.Join(tmp, "removed.jpg")
+	_ = cp.Copy(testdata.Testfile, kept)
+	_ = cp.Copy(testdata.MetadataTestFile, removed)
+
+	cache := NewFolderCache(dirName).(folderCache)
+	for _, src := range []string{kept, removed} {
+		cache.AddImage(src, 640, 480, testdata.CompressQuality, images.FormatJPEG, testdata.ThumbnailFile)
+		cache.AddIndexRecord(src, IndexRecord{})
+	}
+	unknown := addEntry(t, dirName, "a", 100, time.Now())
+
+	_ = os.Remove(removed)
+	result, err := cache.PruneSources(files.IsExisting)
+	assert.Nil(t, err)
+	assert.Equal(t, 2, result.Entries)
+	assert.NoFileExists(t, unknown)
+
+	assert.NotNil(t, cache.CachedImage(kept, 640, 480, testdata.CompressQuality, images.FormatJPEG))
+	assert.NotNil(t, cache.IndexRecord(kept))
+	_, ok := cache.index.get(removed)
+	assert.False(t, ok)
+
+	stats, _ := cache.Stats()
+	assert.Equal(t, 1, stats.Entries)
+}
@@ -4,22 +4,28 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"time"
 
 	cp "github.com/otiai10/copy"
 	"github.com/rs/zerolog/log"
 	"github.com/waynezhang/foto/internal/constants"
 	"github.com/waynezhang/foto/internal/files"
+	"github.com/waynezhang/foto/internal/images"
 )
 
 // Implenmentation
 
 type folderCache struct {
 	directoryName string
+	index         *indexStore
+	lookups       *lookupCounter
 }
 
 func NewFolderCache(directoryName string) Cache {
 	return folderCache{
 		directoryName: directoryName,
+		index:         newIndexStore(filepath.Join(directoryName, indexFileName)),
+		lookups:       &lookupCounter{},
 	}
 }
 
@@ -37,13 +43,13 @@ func (cache folderCache) Migrate() {
 }
 
 // `src` is used to compute checksum, `file` will be copied to the cache
-func (cache folderCache) AddImage(src string, width int, height int, compressQuality int, file string) {
-	checksum, err := files.Checksum(src)
+func (cache folderCache) AddImage(src string, width int, height int, compressQuality int, format images.Format, file string) {
+	checksum, err := cache.Checksum(src)
 	if err != nil {
 		return
 	}
 
-	path := cache.imagePath(*checksum, width, height, compressQuality)
+	path := cache.imagePath(*checksum, width, height, compressQuality, format)
 	log.Debug().Msgf("Add cache image %s for %s", path, src)
 	err = files.EnsureParentDirectory(path)
 	if err != nil {
@@ -53,31 +59,104 @@ func (cache folderCache) AddImage(src string, width int, height int, compressQua
 	_ = cp.Copy(file, path)
 }
 
-func (cache folderCache) CachedImage(src string, width int, height int, compressQuality int) *string {
-	checksum, err := files.Checksum(src)
+func (cache folderCache) CachedImage(src string, width int, height int, compressQuality int, format images.Format) *string {
+	checksum, err := cache.Checksum(src)
 	if err != nil {
 		log.Warn().Msgf("Failed to generate file hash %s (%s).", src, err.Error())
+		cache.lookups.add(false)
 		return nil
 	}
 
-	path := cache.imagePath(*checksum, width, height, compressQuality)
+	path := cache.imagePath(*checksum, width, height, compressQuality, format)
 	if !files.IsExisting(path) {
+		cache.lookups.add(false)
 		return nil
 	}
 
+	// Recently used images are kept by `PruneToSize`
+	now := time.Now()
+	_ = os.Chtimes(path, now, now)
+	cache.lookups.add(true)
+
 	return &path
 }
 
+func (cache folderCache) Checksum(src string) (*string, error) {
+	info, err := os.Stat(src)
+	if err != nil {
+		return nil, err
+	}
+
+	entry, ok, verified := cache.index.checksum(src)
+	if ok && entry.Size == info.Size() && entry.ModTime.Equal(info.ModTime()) && (!Verify || verified) {
+		return &entry.Checksum, nil
+	}
+
+	checksum, err := files.Checksum(src)
+	if err != nil {
+		return nil, err
+	}
+	cache.index.setChecksum(src, checksumEntry{Size: info.Size(), ModTime: info.ModTime(), Checksum: *checksum})
+
+	return checksum, nil
+}
+
+func (cache folderCache) IndexRecord(src string) *IndexRecord {
+	current, err := statRecord(src)
+	if err != nil {
+		return nil
+	}
+
+	record, ok := cache.index.get(src)
+	if !ok || !record.sameFile(current) {
+		return nil
+	}
+
+	// Content changed without changing the size and modification time
+	if Verify {
+		previous, ok, verified := cache.index.checksum(src)
+		if !verified {
+			checksum, err := cache.Checksum(src)
+			if err != nil || !ok || previous.Checksum != *checksum {
+				return nil
+			}
+		}
+	}
+
+	return &record
+}
+
+// The size and modification times of `record` are set to the current ones of `src`
+func (cache folderCache) AddIndexRecord(src string, record IndexRecord) {
+	current, err := statRecord(src)
+	if err != nil {
+		return
+	}
+
+	record.Size = current.Size
+	record.ModTime = current.ModTime
+	record.SidecarModTime = current.SidecarModTime
+	cache.index.set(src, record)
+}
+
+func (cache folderCache) Save() error {
+	if err := cache.index.save(); err != nil {
+		return err
+	}
+	return cache.saveLookups()
+}
+
 func (cache folderCache) Clear() {
 	dir := cache.directoryName
 	if !files.IsExisting(dir) {
 		log.Warn().Msgf("Failed to find cache directory %s.", dir)
 	}
 	_ = files.PruneDirectory(dir)
+	cache.index.clear()
 }
 
-func (cache folderCache) imagePath(checksum string, width int, height int, compressQuality int) string {
-	return filepath.Join(cache.directoryName, fmt.Sprintf("%s-%d-%d-%d", checksum, width, height, compressQuality))
+func (cache folderCache) imagePath(checksum string, width int, height int, compressQuality int, format images.Format) string {
+	return filepath.Join(cache.directoryName, fmt.Sprintf("%s-%d-%d-%d-%s", checksum, width, height, compressQuality, format))
 }
 
 func (cache folderCache) version() string {
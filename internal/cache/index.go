@@ -0,0 +1,216 @@
+package cache
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog/log"
+	"github.com/waynezhang/foto/internal/constants"
+	"github.com/waynezhang/foto/internal/files"
+	"github.com/waynezhang/foto/internal/images"
+)
+
+// File in the cache directory holding index records
+const indexFileName = "index.json"
+
+// What the indexer reads from a photo, reused while the photo and its XMP sidecar are unchanged
+type IndexRecord struct {
+	Size    int64
+	ModTime time.Time
+	// Modification time of the XMP sidecar, zero without one
+	SidecarModTime time.Time
+	// As displayed, with EXIF orientation applied
+	ImageSize images.ImageSize
+	Metadata  images.Metadata
+}
+
+// Checksum of a source file, reused while its size and modification time are unchanged
+type checksumEntry struct {
+	Size     int64
+	ModTime  time.Time
+	Checksum string
+}
+
+// Index records and checksums keyed by source path, loaded on first use
+type indexStore struct {
+	path string
+
+	once      sync.Once
+	mutex     sync.Mutex
+	records   map[string]IndexRecord
+	checksums map[string]checksumEntry
+	// Paths hashed in this run, not hashed again with `Verify`
+	verified map[string]bool
+	changed  bool
+}
+
+type indexFile struct {
+	Version   string
+	Records   map[string]IndexRecord
+	Checksums map[string]checksumEntry
+}
+
+func newIndexStore(path string) *indexStore {
+	return &indexStore{path: path}
+}
+
+func (s *indexStore) load() {
+	s.once.Do(func() {
+		s.records = map[string]IndexRecord{}
+		s.checksums = map[string]checksumEntry{}
+		s.verified = map[string]bool{}
+
+		data, err := os.ReadFile(s.path)
+		if err != nil {
+			return
+		}
+		var f indexFile
+		if err := json.Unmarshal(data, &f); err != nil {
+			log.Warn().Msgf("Failed to read index cache %s (%v)", s.path, err)
+			return
+		}
+		if f.Version != constants.CacheVersion {
+			log.Debug().Msgf("Index cache version %s is not compatible to %s, ignoring", f.Version, constants.CacheVersion)
+			return
+		}
+		if f.Records != nil {
+			s.records = f.Records
+		}
+		if f.Checksums != nil {
+			s.checksums = f.Checksums
+		}
+	})
+}
+
+func (s *indexStore) get(src string) (IndexRecord, bool) {
+	s.load()
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	record, ok := s.records[absolutePath(src)]
+	return record, ok
+}
+
+func (s *indexStore) set(src string, record IndexRecord) {
+	s.load()
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.records[absolutePath(src)] = record
+	s.changed = true
+}
+
+func (s *indexStore) checksum(src string) (checksumEntry, bool, bool) {
+	s.load()
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	path := absolutePath(src)
+	entry, ok := s.checksums[path]
+	return entry, ok, s.verified[path]
+}
+
+func (s *indexStore) setChecksum(src string, entry checksumEntry) {
+	s.load()
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	path := absolutePath(src)
+	s.checksums[path] = entry
+	s.verified[path] = true
+	s.changed = true
+}
+
+// Removes records and checksums of paths `keep` returns false for, returning the remaining checksums
+func (s *indexStore) prune(keep func(path string) bool) map[string]bool {
+	s.load()
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	for path := range s.records {
+		if !keep(path) {
+			delete(s.records, path)
+			s.changed = true
+		}
+	}
+
+	checksums := map[string]bool{}
+	for path, entry := range s.checksums {
+		if !keep(path) {
+			delete(s.checksums, path)
+			s.changed = true
+			continue
+		}
+		checksums[entry.Checksum] = true
+	}
+	return checksums
+}
+
+func (s *indexStore) save() error {
+	s.load()
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if !s.changed {
+		return nil
+	}
+
+	data, err := json.Marshal(indexFile{Version: constants.CacheVersion, Records: s.records, Checksums: s.checksums})
+	if err != nil {
+		return err
+	}
+
+	// Written to a temporary file first so an interrupted export never leaves a broken index
+	tmpPath := s.path + ".tmp"
+	if err := files.WriteDataToFile(data, tmpPath); err != nil {
+		return err
+	}
+	if err := os.Rename(tmpPath, s.path); err != nil {
+		return err
+	}
+
+	s.changed = false
+	return nil
+}
+
+func (s *indexStore) clear() {
+	s.load()
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.records = map[string]IndexRecord{}
+	s.checksums = map[string]checksumEntry{}
+	s.verified = map[string]bool{}
+	s.changed = false
+}
+
+// Records stay valid when the site is run from another directory
+func absolutePath(path string) string {
+	if abs, err := filepath.Abs(path); err == nil {
+		return abs
+	}
+	return path
+}
+
+// Stat of `src` and its sidecar to compare with or store in a record
+func statRecord(src string) (IndexRecord, error) {
+	info, err := os.Stat(src)
+	if err != nil {
+		return IndexRecord{}, err
+	}
+
+	record := IndexRecord{Size: info.Size(), ModTime: info.ModTime()}
+	if sidecar := images.XMPSidecarPath(src); sidecar != "" {
+		if info, err := os.Stat(sidecar); err == nil {
+			record.SidecarModTime = info.ModTime()
+		}
+	}
+	return record, nil
+}
+
+func (r IndexRecord) sameFile(other IndexRecord) bool {
+	return r.Size == other.Size && r.ModTime.Equal(other.ModTime) && r.SidecarModTime.Equal(other.SidecarModTime)
+}
@@ -0,0 +1,79 @@
+package cache
+
+import (
+	"os"
+	"sort"
+
+	"github.com/rs/zerolog/log"
+)
+
+// Cached images removed by pruning
+type PruneResult struct {
+	Entries int
+	Bytes   int64
+}
+
+func (r *PruneResult) add(e cacheEntry) {
+	r.Entries++
+	r.Bytes += e.size
+}
+
+// Removes the least recently used images until the cached images take at most `maxBytes`
+func (cache folderCache) PruneToSize(maxBytes int64) (PruneResult, error) {
+	result := PruneResult{}
+
+	entries, err := cache.entries()
+	if err != nil {
+		return result, err
+	}
+
+	total := int64(0)
+	for _, e := range entries {
+		total += e.size
+	}
+
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].accessTime.Before(entries[j].accessTime)
+	})
+	for _, e := range entries {
+		if total <= maxBytes {
+			break
+		}
+		if err := os.Remove(e.path); err != nil {
+			return result, err
+		}
+		total -= e.size
+		result.add(e)
+	}
+
+	log.Debug().Msgf("Pruned %d cached images (%d bytes) to fit %d bytes", result.Entries, result.Bytes, maxBytes)
+	return result, nil
+}
+
+// Forgets sources `keep` returns false for, given absolute paths, and removes cached images
+// of checksums no source has anymore
+func (cache folderCache) PruneSources(keep func(src string) bool) (PruneResult, error) {
+	result := PruneResult{}
+
+	checksums := cache.index.prune(keep)
+	if err := cache.index.save(); err != nil {
+		return result, err
+	}
+
+	entries, err := cache.entries()
+	if err != nil {
+		return result, err
+	}
+	for _, e := range entries {
+		if checksums[e.checksum] {
+			continue
+		}
+		if err := os.Remove(e.path); err != nil {
+			return result, err
+		}
+		result.add(e)
+	}
+
+	log.Debug().Msgf("Pruned %d cached images (%d bytes) of removed photos", result.Entries, result.Bytes)
+	return result, nil
+}
@@ -0,0 +1,131 @@
+package cache
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sync/atomic"
+	"time"
+
+	"github.com/waynezhang/foto/internal/files"
+)
+
+// File in the cache directory holding lookups of the last export
+const statsFileName = "stats.json"
+
+// Cached images are named by the checksum of their source, e.g. `<sha256>-640-480-75-jpeg`
+var imageNamePattern = regexp.MustCompile(`^([0-9a-f]{64})-`)
+
+// Usage of the cache
+type Stats struct {
+	// Cached images and their total size
+	Entries int
+	Bytes   int64
+	// Lookups of cached images in the last export
+	LastExport Lookups
+}
+
+type Lookups struct {
+	Hits   int64
+	Misses int64
+	Time   time.Time
+}
+
+// Share of lookups found in the cache, 0 without lookups
+func (l Lookups) HitRate() float64 {
+	total := l.Hits + l.Misses
+	if total == 0 {
+		return 0
+	}
+	return float64(l.Hits) / float64(total)
+}
+
+type lookupCounter struct {
+	hits   atomic.Int64
+	misses atomic.Int64
+}
+
+func (c *lookupCounter) add(hit bool) {
+	if hit {
+		c.hits.Add(1)
+	} else {
+		c.misses.Add(1)
+	}
+}
+
+// Cached image in the cache directory
+type cacheEntry struct {
+	path     string
+	checksum string
+	size     int64
+	// Updated on each lookup hit, used for evicting least recently used images
+	accessTime time.Time
+}
+
+func (cache folderCache) Stats() (Stats, error) {
+	entries, err := cache.entries()
+	if err != nil {
+		return Stats{}, err
+	}
+
+	stats := Stats{Entries: len(entries)}
+	for _, e := range entries {
+		stats.Bytes += e.size
+	}
+
+	data, err := os.ReadFile(filepath.Join(cache.directoryName, statsFileName))
+	if err == nil {
+		_ = json.Unmarshal(data, &stats.LastExport)
+	}
+
+	return stats, nil
+}
+
+// Writes the lookups since the cache was created, if any
+func (cache folderCache) saveLookups() error {
+	lookups := Lookups{
+		Hits:   cache.lookups.hits.Load(),
+		Misses: cache.lookups.misses.Load(),
+		Time:   time.Now(),
+	}
+	if lookups.Hits+lookups.Misses == 0 {
+		return nil
+	}
+
+	data, err := json.Marshal(lookups)
+	if err != nil {
+		return err
+	}
+	return files.WriteDataToFile(data, filepath.Join(cache.directoryName, statsFileName))
+}
+
+// Cached images, without the version, index and stats files
+func (cache folderCache) entries() ([]cacheEntry, error) {
+	dirEntries, err := os.ReadDir(cache.directoryName)
+	if os.IsNotExist(err) {
+		return []cacheEntry{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	entries := []cacheEntry{}
+	for _, d := range dirEntries {
+		matches := imageNamePattern.FindStringSubmatch(d.Name())
+		if d.IsDir() || matches == nil {
+			continue
+		}
+		info, err := d.Info()
+		if err != nil {
+			continue
+		}
+		entries = append(entries, cacheEntry{
+			path:       filepath.Join(cache.directoryName, d.Name()),
+			checksum:   matches[1],
+			size:       info.Size(),
+			accessTime: info.ModTime(),
+		})
+	}
+	return entries, nil
+}
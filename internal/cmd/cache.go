@@ -0,0 +1,99 @@
+package cmd
+
+import (
+	"path/filepath"
+	"strings"
+
+	"github.com/rs/zerolog/log"
+	"github.com/spf13/cobra"
+	"github.com/waynezhang/foto/internal/cache"
+	"github.com/waynezhang/foto/internal/config"
+	"github.com/waynezhang/foto/internal/files"
+	"github.com/waynezhang/foto/internal/utils"
+)
+
+var CacheCmd = func() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "cache",
+		Short: "Manage local cache",
+		Run: func(cmd *cobra.Command, args []string) {
+			_ = cmd.Help()
+		},
+	}
+
+	cmd.AddCommand(cacheStatsCmd)
+	cmd.AddCommand(cachePruneCmd)
+
+	return cmd
+}()
+
+var cacheStatsCmd = &cobra.Command{
+	Use:   "stats",
+	Short: "Show size of the cache and hit rate of the last export",
+	Run: func(cmd *cobra.Command, args []string) {
+		stats, err := cache.Shared().Stats()
+		utils.CheckFatalError(err, "Failed to read cache")
+
+		log.Info().Msgf("Entries: %d", stats.Entries)
+		log.Info().Msgf("Size: %s", files.FormatSize(stats.Bytes))
+
+		last := stats.LastExport
+		if last.Hits+last.Misses == 0 {
+			log.Info().Msg("Hit rate: no export yet")
+			return
+		}
+		log.Info().Msgf(
+			"Hit rate: %.1f%% (%d hits, %d misses, exported at %s)",
+			last.HitRate()*100, last.Hits, last.Misses, last.Time.Format("2006-01-02 15:04:05"),
+		)
+	},
+}
+
+var cachePruneCmd = func() *cobra.Command {
+	var maxSize string
+
+	cmd := &cobra.Command{
+		Use:   "prune",
+		Short: "Remove cached images of removed photos and least recently used ones over --max-size",
+		Run: func(cmd *cobra.Command, args []string) {
+			c := cache.Shared()
+
+			folders := []string{}
+			for _, s := range config.Shared().GetSectionMetadata() {
+				if abs, err := filepath.Abs(s.Folder); err == nil {
+					folders = append(folders, abs)
+				}
+			}
+			result, err := c.PruneSources(func(src string) bool {
+				return inFolders(src, folders) && files.IsExisting(src)
+			})
+			utils.CheckFatalError(err, "Failed to prune cache")
+			log.Info().Msgf("Removed %d images (%s) of removed photos.", result.Entries, files.FormatSize(result.Bytes))
+
+			if maxSize == "" {
+				return
+			}
+			maxBytes, err := files.ParseSize(maxSize)
+			utils.CheckFatalError(err, "Failed to parse --max-size")
+
+			result, err = c.PruneToSize(maxBytes)
+			utils.CheckFatalError(err, "Failed to prune cache")
+			log.Info().Msgf("Removed %d least recently used images (%s).", result.Entries, files.FormatSize(result.Bytes))
+		},
+	}
+
+	cmd.Flags().StringVar(&maxSize, "max-size", "", "Maximum size of cached images, e.g. 500MB or 5GB")
+
+	return cmd
+}()
+
+// Whether `path` is in one of `folders` or their subfolders
+func inFolders(path string, folders []string) bool {
+	for _, folder := range folders {
+		rel, err := filepath.Rel(folder, path)
+		if err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+			return true
+		}
+	}
+	return false
+}
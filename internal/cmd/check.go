@@ -0,0 +1,42 @@
+package cmd
+
+import (
+	"os"
+
+	"github.com/rs/zerolog/log"
+	"github.com/spf13/cobra"
+	"github.com/waynezhang/foto/internal/config"
+	"github.com/waynezhang/foto/internal/constants"
+)
+
+var CheckCmd = &cobra.Command{
+	Use:   "check",
+	Short: "Check the config file for errors",
+	Run: func(cmd *cobra.Command, args []string) {
+		if !validateConfig() {
+			os.Exit(1)
+		}
+		log.Info().Msgf("No problems found in %s.", constants.ConfigFilePath)
+	},
+}
+
+// Logs problems of the config file, false if there is any besides warnings
+func validateConfig() bool {
+	valid := true
+	for _, p := range config.Validate(constants.ConfigFilePath) {
+		if p.Warning {
+			log.Warn().Msg(p.String())
+			continue
+		}
+		log.Error().Msg(p.String())
+		valid = false
+	}
+	return valid
+}
+
+// Exits before any processing when the config file has problems
+func mustValidateConfig() {
+	if !validateConfig() {
+		log.Fatal().Msgf("Please fix the problems in %s first.", constants.ConfigFilePath)
+	}
+}
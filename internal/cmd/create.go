@@ -46,6 +46,10 @@ func extractFiles(to string) error {
 			return err
 		}
 		if d.IsDir() {
+			// Built-in themes are used from the binary
+			if path == "static/themes" {
+				return fs.SkipDir
+			}
 			return nil
 		}
 
@@ -2,15 +2,18 @@ package cmd
 
 import (
 	"github.com/spf13/cobra"
+	"github.com/waynezhang/foto/internal/cache"
 	"github.com/waynezhang/foto/internal/export"
 )
 
 var ExportCmd = func() *cobra.Command {
 	var outputPath string
 	var minimize bool
+	var incremental bool
 
 	fn := func(cmd *cobra.Command, args []string) {
-		export.Export(outputPath, minimize)
+		mustValidateConfig()
+		export.Export(outputPath, minimize, incremental)
 	}
 
 	cmd := &cobra.Command{
@@ -20,6 +23,8 @@ var ExportCmd = func() *cobra.Command {
 	}
 	cmd.Flags().StringVarP(&outputPath, "output", "o", "dist", "Output directory")
 	cmd.Flags().BoolVarP(&minimize, "minimize", "m", false, "Wether minimize output files(css, html, js supported) or not")
+	cmd.Flags().BoolVar(&cache.Verify, "verify", false, "Hash every source photo instead of trusting unchanged sizes and modification times")
+	cmd.Flags().BoolVarP(&incremental, "incremental", "i", false, "Only rewrite changed files and remove orphaned ones instead of recreating the output directory")
 
 	return cmd
 }()
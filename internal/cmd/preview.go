@@ -1,22 +1,32 @@
 package cmd
 
 import (
+	"bytes"
 	"fmt"
-	"html/template"
 	"net/http"
 	"path/filepath"
+	"slices"
 	"strings"
+	"sync"
 
 	"github.com/rs/zerolog/log"
 	"github.com/spf13/cobra"
+	"github.com/waynezhang/foto/internal/cache"
 	"github.com/waynezhang/foto/internal/config"
 	"github.com/waynezhang/foto/internal/constants"
+	"github.com/waynezhang/foto/internal/files"
 	"github.com/waynezhang/foto/internal/images"
 	"github.com/waynezhang/foto/internal/indexer"
+	"github.com/waynezhang/foto/internal/libraries"
+	"github.com/waynezhang/foto/internal/pages"
+	"github.com/waynezhang/foto/internal/theme"
 	"github.com/waynezhang/foto/internal/utils"
+	"github.com/waynezhang/foto/internal/watcher"
+	"github.com/waynezhang/foto/internal/workers"
 )
 
 var port = 5000
+var watch = false
 
 var PreviewCmd = func() *cobra.Command {
 	cmd := &cobra.Command{
@@ -25,27 +35,64 @@ var PreviewCmd = func() *cobra.Command {
 		Run:   preview,
 	}
 	cmd.Flags().IntVarP(&port, "port", "p", 5000, "Port")
+	cmd.Flags().BoolVarP(&watch, "watch", "w", false, "Rebuild and reload the browser when photos, config or template change")
 
 	return cmd
 }()
 
+// Config and index served by preview, replaced on rebuild in watch mode
+type previewState struct {
+	mutex    sync.RWMutex
+	config   config.Config
+	sections []indexer.Section
+}
+
+func (s *previewState) get() (config.Config, []indexer.Section) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	return s.config, s.sections
+}
+
+func (s *previewState) set(cfg config.Config, sections []indexer.Section) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.config = cfg
+	s.sections = sections
+}
+
 func preview(cmd *cobra.Command, args []string) {
 	log.Debug().Msg("Creating Preview...")
 
+	mustValidateConfig()
+
 	config := config.Shared()
-	index, err := indexer.Build(config.GetSectionMetadata(), config.GetExtractOption())
+	index, err := indexer.Build(config.GetSectionMetadata(), config.GetExtractOption(), cache.Shared())
 	utils.CheckFatalError(err, "Failed to build index")
 
+	state := &previewState{config: config, sections: index}
+
+	var broker *watcher.ReloadBroker
+	if watch {
+		broker = watcher.NewReloadBroker()
+		http.Handle(constants.LiveReloadURLPath, broker)
+
+		err := watchChanges(state, broker)
+		utils.CheckFatalError(err, "Failed to watch files")
+	}
+
 	http.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		config, index := state.get()
 		handleRoot(
 			config,
 			index,
+			broker != nil,
 			w,
 			r,
 		)
 	})
 
 	http.HandleFunc(constants.PhotosURLPath, func(w http.ResponseWriter, r *http.Request) {
+		config, index := state.get()
 		handleImage(
 			strings.TrimPrefix(r.URL.Path, constants.PhotosURLPath),
 			config,
@@ -55,27 +102,131 @@ func preview(cmd *cobra.Command, args []string) {
 		)
 	})
 
-	otherFolders := config.GetOtherFolders()
-	for _, folder := range otherFolders {
-		dir := http.FileServer(http.Dir(folder))
-		path := "/" + folder + "/"
-		http.Handle(path, http.StripPrefix(path, dir))
-	}
+	libraryPath := "/" + libraries.DirectoryName + "/"
+	http.Handle(libraryPath, http.StripPrefix(libraryPath, http.FileServer(http.FS(libraries.Source()))))
 
 	log.Info().Msgf("Server started -> http://localhost:%d", port)
 	err = http.ListenAndServe(fmt.Sprintf(":%d", port), nil)
 	utils.CheckFatalError(err, "Failed to listen the port")
 }
 
-func handleRoot(cfg config.Config, sections []indexer.Section, w http.ResponseWriter, _ *http.Request) {
-	tmpl := template.Must(template.ParseFiles(constants.TemplateFilePath))
-	_ = tmpl.Execute(w, struct {
-		Config   map[string]any
-		Sections []indexer.Section
-	}{
-		cfg.AllSettings(),
-		sections,
+func watchChanges(state *previewState, broker *watcher.ReloadBroker) error {
+	var w *watcher.Watcher
+	var err error
+
+	w, err = watcher.New(func() {
+		log.Info().Msg("Changes detected, rebuilding...")
+
+		cfg, err := config.LoadFileConfig(constants.ConfigFilePath)
+		if err != nil {
+			log.Error().Msgf("Failed to parse config file (%v)", err)
+			return
+		}
+		index, err := indexer.Build(cfg.GetSectionMetadata(), cfg.GetExtractOption(), cache.Shared())
+		if err != nil {
+			log.Error().Msgf("Failed to build index (%v)", err)
+			return
+		}
+
+		state.set(cfg, index)
+		config.SetShared(cfg)
+		w.Reset(watchedPaths(cfg))
+		broker.Reload()
 	})
+	if err != nil {
+		return err
+	}
+
+	cfg, _ := state.get()
+	w.Reset(watchedPaths(cfg))
+
+	return nil
+}
+
+func watchedPaths(cfg config.Config) []string {
+	paths := []string{constants.ConfigFilePath}
+	if envFile := config.EnvironmentFile(constants.ConfigFilePath); envFile != "" {
+		paths = append(paths, envFile)
+	}
+	paths = append(paths, templatePaths(cfg.GetPageOption())...)
+	for _, s := range cfg.GetSectionMetadata() {
+		paths = append(paths, s.Folder)
+	}
+	paths = append(paths, cfg.GetOtherFolders()...)
+
+	return paths
+}
+
+// Page templates with their layouts and partials, or the folder of the theme
+func templatePaths(option config.PageOption) []string {
+	if option.Theme != "" {
+		t, err := theme.Load(option.Theme)
+		if err != nil || t.Dir == "" {
+			// Built-in themes never change
+			return []string{}
+		}
+		return []string{t.Dir}
+	}
+
+	templates := []string{option.Template}
+	if option.MultiPage {
+		templates = append(templates, option.IndexTemplate, option.SectionTemplate)
+	}
+	paths := []string{}
+	for _, template := range templates {
+		paths = append(paths, template)
+		for _, dir := range []string{"layouts", "partials"} {
+			if shared := filepath.Join(filepath.Dir(template), dir); files.IsExisting(shared) && !slices.Contains(paths, shared) {
+				paths = append(paths, shared)
+			}
+		}
+	}
+	return paths
+}
+
+func handleRoot(cfg config.Config, sections []indexer.Section, liveReload bool, w http.ResponseWriter, r *http.Request) {
+	page := pages.Find(pages.Build(cfg.GetPageOption(), sections), r.URL.Path)
+	if page == nil {
+		if !handleOtherFolders(cfg, w, r) {
+			handleThemeStatic(cfg, w, r)
+		}
+		return
+	}
+
+	buf := new(bytes.Buffer)
+	if err := pages.Render(buf, cfg, sections, *page); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	data := buf.Bytes()
+	if liveReload {
+		data = watcher.InjectReloadScript(data, constants.LiveReloadURLPath)
+	}
+	_, _ = w.Write(data)
+}
+
+// Serves files of folders in [others] where export copies them, e.g. `/assets/`.
+// False if the path is in none of them.
+func handleOtherFolders(cfg config.Config, w http.ResponseWriter, r *http.Request) bool {
+	for _, folder := range cfg.GetOtherFolders() {
+		path := "/" + filepath.Base(folder) + "/"
+		if strings.HasPrefix(r.URL.Path, path) {
+			http.StripPrefix(path, http.FileServer(http.Dir(folder))).ServeHTTP(w, r)
+			return true
+		}
+	}
+	return false
+}
+
+// Static assets of the theme, served at the site root as on export
+func handleThemeStatic(cfg config.Config, w http.ResponseWriter, r *http.Request) {
+	t, err := theme.Load(cfg.GetPageOption().Theme)
+	if err != nil || t.Static() == nil {
+		http.NotFound(w, r)
+		return
+	}
+	http.FileServer(http.FS(t.Static())).ServeHTTP(w, r)
 }
 
 func handleImage(path string, cfg config.Config, sections []indexer.Section, w http.ResponseWriter, r *http.Request) {
@@ -91,15 +242,26 @@ func handleImage(path string, cfg config.Config, sections []indexer.Section, w h
 
 	var file_path string
 	var size images.ImageSize
-	for _, s := range sections {
+	var format images.Format
+	for _, s := range indexer.Flatten(sections) {
 		if s.Slug == slug {
 			for _, is := range s.ImageSets {
-				if is.FileName == file {
-					file_path = filepath.Join(s.Folder, file)
+				for _, v := range is.OutputVariants() {
+					if v.FileName != file {
+						continue
+					}
+					file_path = is.SourcePath(s.Folder)
+					format = v.Format
 					if key == "thumbnail" {
 						size = is.ThumbnailSize
 					} else if key == "original" {
 						size = is.OriginalSize
+					} else {
+						for _, t := range is.Thumbnails {
+							if t.Key == key {
+								size = t.Size
+							}
+						}
 					}
 					break
 				}
@@ -112,13 +274,17 @@ func handleImage(path string, cfg config.Config, sections []indexer.Section, w h
 		return
 	}
 
-	data, err := images.ResizeData(file_path, size.Width, size.Height, cfg.GetExtractOption().CompressQuality)
+	var data *bytes.Buffer
+	var err error
+	workers.Shared().Run(images.DecodedBytes(file_path), func() {
+		data, err = images.ResizeData(file_path, size.Width, size.Height, cfg.GetExtractOption().CompressQuality, format)
+	})
 	if err != nil {
 		http.NotFound(w, r)
 		return
 	}
 
-	w.Header().Set("Content-Type", "image/jpeg")
+	w.Header().Set("Content-Type", format.MIMEType())
 	w.Header().Set("Cache-Control", "no-cache, private, max-age=0")
 	_, _ = w.Write(data.Bytes())
 }
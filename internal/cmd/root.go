@@ -2,17 +2,23 @@ package cmd
 
 import (
 	"os"
+	"path/filepath"
 
 	"github.com/rs/zerolog"
 	"github.com/rs/zerolog/log"
 	"github.com/spf13/cobra"
+	"github.com/waynezhang/foto/internal/config"
+	"github.com/waynezhang/foto/internal/constants"
 	"github.com/waynezhang/foto/internal/utils"
+	"github.com/waynezhang/foto/internal/workers"
 )
 
 func Execute() {
 	log.Logger = log.Output(zerolog.ConsoleWriter{Out: os.Stderr})
 
 	var verbose bool
+	var configFile string
+	var siteDir string
 	var rootCmd = &cobra.Command{
 		Use:   "foto",
 		Short: "Yet another publishing tool for photographers",
@@ -25,11 +31,28 @@ func Execute() {
 			} else {
 				zerolog.SetGlobalLevel(zerolog.InfoLevel)
 			}
+
+			if !cmd.Flags().Changed("config") {
+				// foto.toml of the site directory
+				configFile = ""
+			}
+			if workers.Jobs < 1 {
+				log.Fatal().Msgf("--jobs needs to be positive, got %d", workers.Jobs)
+			}
+
+			err := useSite(configFile, siteDir)
+			utils.CheckFatalError(err, "Failed to use site directory")
 		},
 	}
 
 	rootCmd.PersistentFlags().BoolVarP(&verbose, "verbose", "v", false, "verbose output")
+	rootCmd.PersistentFlags().StringVarP(&configFile, "config", "c", constants.ConfigFilePath, "config file, relative to the current directory")
+	rootCmd.PersistentFlags().StringVar(&siteDir, "site-dir", "", "site directory (default is the directory of the config file)")
+	rootCmd.PersistentFlags().IntVarP(&workers.Jobs, "jobs", "j", workers.Jobs, "number of photos processed at a time")
+	rootCmd.PersistentFlags().StringVarP(&config.Environment, "env", "e", "", "environment whose config file overrides the config file, e.g. production for foto.production.toml")
 
+	rootCmd.AddCommand(CacheCmd)
+	rootCmd.AddCommand(CheckCmd)
 	rootCmd.AddCommand(ClearCacheCmd)
 	rootCmd.AddCommand(CreateCmd)
 	rootCmd.AddCommand(ExportCmd)
@@ -39,3 +62,36 @@ func Execute() {
 	err := rootCmd.Execute()
 	utils.CheckFatalError(err, "Failed to execute command.")
 }
+
+// Changes into the site directory so the cache, templates and output are relative to it.
+// The site directory defaults to the directory of `configFile`, which defaults to foto.toml of the site directory.
+func useSite(configFile string, siteDir string) error {
+	if configFile == "" && siteDir == "" {
+		return nil
+	}
+
+	if configFile != "" {
+		abs, err := filepath.Abs(configFile)
+		if err != nil {
+			return err
+		}
+		configFile = abs
+		if siteDir == "" {
+			siteDir = filepath.Dir(configFile)
+		}
+	}
+	siteDir, err := filepath.Abs(siteDir)
+	if err != nil {
+		return err
+	}
+
+	if configFile != "" {
+		if rel, err := filepath.Rel(siteDir, configFile); err == nil {
+			configFile = rel
+		}
+		constants.ConfigFilePath = configFile
+	}
+
+	log.Debug().Msgf("Using site directory %s with config file %s", siteDir, constants.ConfigFilePath)
+	return os.Chdir(siteDir)
+}
@@ -1,14 +1,20 @@
 package config
 
 import (
-	"html/template"
+	"path/filepath"
+	"regexp"
+	"strings"
 	"sync"
+
+	"github.com/waynezhang/foto/internal/constants"
 )
 
 type Config interface {
 	GetSectionMetadata() []SectionMetadata
 	GetExtractOption() ExtractOption
 	GetOtherFolders() []string
+	GetPageOption() PageOption
+	GetLibraryOption() LibraryOption
 	AllSettings() map[string]any
 }
 
@@ -18,29 +24,110 @@ type ExtractOption struct {
 	OriginalWidth      int
 	MinOriginalHeight  int
 	CompressQuality    int
+	Formats            []string
+	ThumbnailWidths    []int
+	// Name output files by a hash of their content so they can be cached as immutable
+	HashFileNames bool
+}
+
+// Layout of the generated pages, from `[pages]` and `theme`
+type PageOption struct {
+	// Folder or built-in theme providing templates, empty for the templates of the site
+	Theme string
+	// Render an index page listing sections plus one page per section instead of a single page
+	MultiPage bool
+	// Template of single-page sites. Page templates are relative to the theme when one is set.
+	Template        string
+	IndexTemplate   string
+	SectionTemplate string
+}
+
+// Where templates load JavaScript and CSS libraries from, from `[libraries]`
+type LibraryOption struct {
+	// Serve the vendored copies with the site instead of loading them from CDNs
+	Local bool
 }
 
 type SectionMetadata struct {
-	Title              string
-	Text               template.HTML
-	Slug               string
-	Folder             string
-	Ascending          bool
+	Title string
+	// Markdown, rendered to HTML at index time
+	Text string
+	// Markdown file in the section folder appended to `Text`
+	TextFile  string
+	Slug      string
+	Folder    string
+	Ascending bool
+	Sort      string
+	PageSize  int
+	// Treat subdirectories as sub-albums instead of including their photos
+	SubAlbums          bool
 	ThumbnailWidth     int
 	MinThumbnailHeight int
 	OriginalWidth      int
 	MinOriginalHeight  int
+	ThumbnailWidths    []int
 }
 
+// Values of `sort` of sections
+const (
+	SortByFileName = "filename"
+	SortByModTime  = "mtime"
+	SortManually   = "manual"
+	// Followed by an EXIF tag name, e.g. `exif:DateTimeOriginal`
+	SortByEXIFPrefix = "exif:"
+)
+
+func ValidSort(sortBy string) bool {
+	switch sortBy {
+	case "", SortByFileName, SortByModTime, SortManually:
+		return true
+	}
+	return strings.HasPrefix(sortBy, SortByEXIFPrefix) && len(sortBy) > len(SortByEXIFPrefix)
+}
+
+var validSlugPattern = regexp.MustCompile("^[a-zA-Z0-9-_]+$")
+
+// Slugs of sections and sub-albums become folders of the output
+func ValidSlug(slug string) bool {
+	return validSlugPattern.MatchString(slug)
+}
+
+// Prefix of environment variables overriding config values
+const envPrefix = "FOTO"
+
 var (
 	once     sync.Once
+	mutex    sync.RWMutex
 	instance Config
+
+	// Environment whose config file, e.g. `foto.production.toml`, overrides the config file. Set by `--env`.
+	Environment string
 )
 
+// Config file of `Environment` next to `file`, e.g. `foto.production.toml`, empty without an environment
+func EnvironmentFile(file string) string {
+	if Environment == "" {
+		return ""
+	}
+	ext := filepath.Ext(file)
+	return strings.TrimSuffix(file, ext) + "." + Environment + ext
+}
+
 func Shared() Config {
 	once.Do(func() {
-		instance = NewFileConfig("./foto.toml")
+		instance = NewFileConfig(constants.ConfigFilePath)
 	})
 
+	mutex.RLock()
+	defer mutex.RUnlock()
 	return instance
 }
+
+// Replaces the config returned by `Shared`, e.g. when preview reloads the config file
+func SetShared(cfg Config) {
+	once.Do(func() {})
+
+	mutex.Lock()
+	defer mutex.Unlock()
+	instance = cfg
+}
@@ -1,6 +1,8 @@
 package config
 
 import (
+	"os"
+	"path/filepath"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -10,6 +12,8 @@ import (
 
 func TestFileConfig(t *testing.T) {
 	cfg := NewFileConfig(testdata.TestConfigFile)
+	home, _ := os.UserHomeDir()
+	base, _ := filepath.Abs(filepath.Dir(testdata.TestConfigFile))
 
 	assert.Equal(t, 640, cfg.GetExtractOption().ThumbnailWidth)
 	assert.Equal(t, 2048, cfg.GetExtractOption().OriginalWidth)
@@ -18,14 +22,20 @@ func TestFileConfig(t *testing.T) {
 	sections := cfg.GetSectionMetadata()
 	assert.Equal(t, "Section 1", sections[0].Title)
 	assert.Equal(t, "section-1", sections[0].Slug)
-	assert.Equal(t, "~/photos/section-1", sections[0].Folder)
+	assert.Equal(t, filepath.Join(home, "photos/section-1"), sections[0].Folder)
 	assert.Equal(t, false, sections[0].Ascending)
 	assert.Equal(t, "Section 2", sections[1].Title)
 	assert.Equal(t, "section-2", sections[1].Slug)
-	assert.Equal(t, "~/photos/section-2", sections[1].Folder)
+	assert.Equal(t, filepath.Join(home, "photos/section-2"), sections[1].Folder)
 	assert.Equal(t, false, sections[1].Ascending)
 
-	assert.Equal(t, []string{"assets", "media"}, cfg.GetOtherFolders())
+	assert.Equal(t, []string{filepath.Join(base, "assets"), filepath.Join(base, "media")}, cfg.GetOtherFolders())
+
+	assert.False(t, cfg.GetPageOption().MultiPage)
+	assert.Empty(t, cfg.GetPageOption().Theme)
+	assert.Equal(t, filepath.Join(base, constants.TemplateFilePath), cfg.GetPageOption().Template)
+	assert.Equal(t, filepath.Join(base, constants.IndexTemplateFilePath), cfg.GetPageOption().IndexTemplate)
+	assert.Equal(t, filepath.Join(base, constants.SectionTemplateFilePath), cfg.GetPageOption().SectionTemplate)
 
 	// Test PhotoSwipe version
 	assert.NotNil(t, cfg.AllSettings()["photoswipeversion"])
@@ -41,3 +51,93 @@ func TestFileConfigV2(t *testing.T) {
 	cfg := NewFileConfig(testdata.TestConfigFileV2)
 	assert.Equal(t, 88, cfg.GetExtractOption().CompressQuality)
 }
+
+func TestFileConfigTheme(t *testing.T) {
+	tmp := t.TempDir()
+	path := filepath.Join(tmp, "foto.toml")
+	_ = os.WriteFile(path, []byte("theme = \"default\"\n[layout]\nmaxColumn = 3\n"), 0644)
+
+	cfg, err := LoadFileConfig(path)
+	assert.Nil(t, err)
+	assert.Equal(t, "default", cfg.GetPageOption().Theme)
+	assert.Equal(t, "template.html", cfg.GetPageOption().Template)
+	assert.Equal(t, "index.html", cfg.GetPageOption().IndexTemplate)
+	assert.Equal(t, "section.html", cfg.GetPageOption().SectionTemplate)
+
+	// Theme values are merged with the config file
+	layout := cfg.AllSettings()["layout"].(map[string]any)
+	assert.EqualValues(t, 3, layout["maxcolumn"])
+	assert.EqualValues(t, 1, layout["mincolumn"])
+	assert.EqualValues(t, 8, layout["gap"])
+}
+
+func TestFileConfigMissingTheme(t *testing.T) {
+	tmp := t.TempDir()
+	path := filepath.Join(tmp, "foto.toml")
+	_ = os.WriteFile(path, []byte("theme = \"not-existing\"\n"), 0644)
+
+	_, err := LoadFileConfig(path)
+	assert.NotNil(t, err)
+}
+
+func useEnvironment(t *testing.T, env string) {
+	Environment = env
+	t.Cleanup(func() { Environment = "" })
+}
+
+func TestEnvironmentFile(t *testing.T) {
+	assert.Empty(t, EnvironmentFile("foto.toml"))
+
+	useEnvironment(t, "production")
+	assert.Equal(t, "foto.production.toml", EnvironmentFile("foto.toml"))
+	assert.Equal(t, filepath.Join("site", "foto.production.toml"), EnvironmentFile(filepath.Join("site", "foto.toml")))
+}
+
+func TestFileConfigEnvironment(t *testing.T) {
+	tmp := t.TempDir()
+	path := filepath.Join(tmp, "foto.toml")
+	_ = os.WriteFile(path, []byte("[image]\nthumbnailWidth = 640\noriginalWidth = 2048\ncompressQuality = 75\n[site]\ntitle = \"Site\"\n"), 0644)
+	_ = os.WriteFile(filepath.Join(tmp, "foto.production.toml"), []byte("[image]\noriginalWidth = 4096\n"), 0644)
+
+	useEnvironment(t, "production")
+	t.Setenv("FOTO_IMAGE_COMPRESSQUALITY", "90")
+	t.Setenv("FOTO_SITE_TITLE", "Production")
+
+	cfg, err := LoadFileConfig(path)
+	assert.Nil(t, err)
+	assert.Equal(t, 640, cfg.GetExtractOption().ThumbnailWidth)
+	assert.Equal(t, 4096, cfg.GetExtractOption().OriginalWidth)
+	assert.Equal(t, 90, cfg.GetExtractOption().CompressQuality)
+	assert.Equal(t, "Production", cfg.AllSettings()["site"].(map[string]any)["title"])
+}
+
+func TestFileConfigMissingEnvironment(t *testing.T) {
+	useEnvironment(t, "staging")
+
+	_, err := LoadFileConfig(testdata.TestConfigFile)
+	assert.ErrorContains(t, err, "foto.staging.toml")
+}
+
+func TestValidSlug(t *testing.T) {
+	assert.True(t, ValidSlug("abcde-efg_9999"))
+	assert.False(t, ValidSlug("abcde efg_9999"))
+	assert.False(t, ValidSlug("abcde-efgかたかな"))
+	assert.False(t, ValidSlug("abcde.efg_999"))
+	assert.False(t, ValidSlug(""))
+}
+
+func TestValidSort(t *testing.T) {
+	assert.True(t, ValidSort(""))
+	assert.True(t, ValidSort("filename"))
+	assert.True(t, ValidSort("mtime"))
+	assert.True(t, ValidSort("manual"))
+	assert.True(t, ValidSort("exif:DateTimeOriginal"))
+	assert.False(t, ValidSort("exif:"))
+	assert.False(t, ValidSort("date"))
+}
+
+func TestSetShared(t *testing.T) {
+	cfg := NewFileConfig(testdata.TestConfigFile)
+	SetShared(cfg)
+	assert.Equal(t, cfg, Shared())
+}
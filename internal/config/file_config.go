@@ -1,43 +1,172 @@
 package config
 
 import (
+	"fmt"
+	"path/filepath"
+	"strings"
+
 	"github.com/rs/zerolog/log"
 	"github.com/spf13/viper"
 	"github.com/waynezhang/foto/internal/constants"
+	"github.com/waynezhang/foto/internal/files"
+	"github.com/waynezhang/foto/internal/theme"
 	"github.com/waynezhang/foto/internal/utils"
 )
 
 type fileConfig struct {
-	v            *viper.Viper
-	option       ExtractOption
-	sections     []SectionMetadata
-	otherFolders []string
+	v             *viper.Viper
+	option        ExtractOption
+	sections      []SectionMetadata
+	otherFolders  []string
+	pageOption    PageOption
+	libraryOption LibraryOption
 }
 
 func NewFileConfig(file string) Config {
-	v := viper.New()
-	v.SetConfigFile(file)
+	config, err := LoadFileConfig(file)
+	utils.CheckFatalError(err, "Failed to parse config file "+file)
+
+	return config
+}
 
-	err := v.ReadInConfig()
-	utils.CheckFatalError(err, "Failed to parse config file foto.toml")
+// Same as `NewFileConfig` but returns the error instead of exiting, e.g. for reloading in preview
+func LoadFileConfig(file string) (Config, error) {
+	v, err := loadLayers(file)
+	if err != nil {
+		return nil, err
+	}
+
+	base := baseDirectory(file)
+	themeName := resolveTheme(v.GetString("theme"), base)
+	if err := applyThemeDefaults(v, themeName); err != nil {
+		return nil, err
+	}
 
 	// Inject PhotoSwipeVersion
 	v.Set("PhotoSwipeVersion", constants.PhotoSwipeVersion)
 	v.Set("PhotoSwipeCaptionPluginVersion", constants.PhotoSwipeCaptionPluginVersion)
 
+	// Nested keys only see environment variables through `AllSettings`
+	v, err = flatten(v)
+	if err != nil {
+		return nil, err
+	}
+
 	config := fileConfig{v: v}
 
-	_ = v.UnmarshalKey("section", &config.sections)
-	_ = v.UnmarshalKey("image", &config.option)
-	_ = v.UnmarshalKey("others.folders", &config.otherFolders)
+	for key, target := range map[string]any{
+		"section":        &config.sections,
+		"image":          &config.option,
+		"others.folders": &config.otherFolders,
+		"pages":          &config.pageOption,
+		"libraries":      &config.libraryOption,
+	} {
+		if err := v.UnmarshalKey(key, target); err != nil {
+			return nil, fmt.Errorf("invalid value in %s (%v)", key, err)
+		}
+	}
 
 	if config.option.CompressQuality == 0 {
 		config.option.CompressQuality = constants.DefaultCompressQuality
 	}
+	config.pageOption.Theme = themeName
+	templates := []string{constants.TemplateFilePath, constants.IndexTemplateFilePath, constants.SectionTemplateFilePath}
+	if themeName != "" {
+		// Page templates of themes are at their root
+		for i, path := range templates {
+			templates[i] = filepath.Base(path)
+		}
+	}
+	if config.pageOption.Template == "" {
+		config.pageOption.Template = templates[0]
+	}
+	if config.pageOption.IndexTemplate == "" {
+		config.pageOption.IndexTemplate = templates[1]
+	}
+	if config.pageOption.SectionTemplate == "" {
+		config.pageOption.SectionTemplate = templates[2]
+	}
+	if themeName == "" {
+		config.pageOption.Template = resolvePath(config.pageOption.Template, base)
+		config.pageOption.IndexTemplate = resolvePath(config.pageOption.IndexTemplate, base)
+		config.pageOption.SectionTemplate = resolvePath(config.pageOption.SectionTemplate, base)
+	}
+
+	for i := range config.sections {
+		config.sections[i].Folder = resolvePath(config.sections[i].Folder, base)
+	}
+	for i := range config.otherFolders {
+		config.otherFolders[i] = resolvePath(config.otherFolders[i], base)
+	}
 
 	log.Debug().Msgf("Config parsed: %v", config)
 
-	return config
+	return config, nil
+}
+
+// The config file, overridden by the file of `Environment` and by `FOTO_*` environment variables
+func loadLayers(file string) (*viper.Viper, error) {
+	v := viper.New()
+	v.SetConfigFile(file)
+	if err := v.ReadInConfig(); err != nil {
+		return nil, err
+	}
+
+	if envFile := EnvironmentFile(file); envFile != "" {
+		if !files.IsExisting(envFile) {
+			return nil, fmt.Errorf("config file %s of environment %s is not found", envFile, Environment)
+		}
+		v.SetConfigFile(envFile)
+		if err := v.MergeInConfig(); err != nil {
+			return nil, err
+		}
+	}
+
+	// e.g. `FOTO_IMAGE_COMPRESSQUALITY` for `compressQuality` in [image]
+	v.SetEnvPrefix(envPrefix)
+	v.SetEnvKeyReplacer(strings.NewReplacer(".", "_"))
+	v.AutomaticEnv()
+
+	return v, nil
+}
+
+func flatten(v *viper.Viper) (*viper.Viper, error) {
+	flattened := viper.New()
+	if err := flattened.MergeConfigMap(v.AllSettings()); err != nil {
+		return nil, err
+	}
+	return flattened, nil
+}
+
+// Config values of the theme become defaults overridden by the config file
+func applyThemeDefaults(v *viper.Viper, name string) error {
+	if name == "" {
+		return nil
+	}
+
+	t, err := theme.Load(name)
+	if err != nil {
+		return err
+	}
+	defaults, err := t.Defaults()
+	if err != nil {
+		return err
+	}
+
+	// Set leaves one by one so tables are merged with the config file instead of replaced
+	var setDefaults func(prefix string, values map[string]any)
+	setDefaults = func(prefix string, values map[string]any) {
+		for key, value := range values {
+			if table, ok := value.(map[string]any); ok {
+				setDefaults(prefix+key+".", table)
+			} else {
+				v.SetDefault(prefix+key, value)
+			}
+		}
+	}
+	setDefaults("", defaults)
+
+	return nil
 }
 
 func (cfg fileConfig) GetSectionMetadata() []SectionMetadata {
@@ -52,6 +181,14 @@ func (cfg fileConfig) GetOtherFolders() []string {
 	return cfg.otherFolders
 }
 
+func (cfg fileConfig) GetPageOption() PageOption {
+	return cfg.pageOption
+}
+
+func (cfg fileConfig) GetLibraryOption() LibraryOption {
+	return cfg.libraryOption
+}
+
 func (cfg fileConfig) AllSettings() map[string]any {
 	return cfg.v.AllSettings()
 }
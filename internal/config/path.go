@@ -0,0 +1,46 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// `path` with `~` and environment variables expanded, relative to `base` unless absolute
+func resolvePath(path string, base string) string {
+	if path == "" {
+		return path
+	}
+
+	if path == "~" || strings.HasPrefix(path, "~/") || strings.HasPrefix(path, "~"+string(filepath.Separator)) {
+		if home, err := os.UserHomeDir(); err == nil {
+			path = filepath.Join(home, path[1:])
+		}
+	}
+	path = os.ExpandEnv(path)
+
+	if filepath.IsAbs(path) {
+		return filepath.Clean(path)
+	}
+	return filepath.Join(base, path)
+}
+
+// Theme folder resolved as a path, or the name of a built-in theme when no such folder exists
+func resolveTheme(name string, base string) string {
+	if name == "" {
+		return name
+	}
+	if path := resolvePath(name, base); isDirectory(path) {
+		return path
+	}
+	return name
+}
+
+// Folder relative paths in the config file are resolved against
+func baseDirectory(file string) string {
+	abs, err := filepath.Abs(file)
+	if err != nil {
+		return filepath.Dir(file)
+	}
+	return filepath.Dir(abs)
+}
@@ -0,0 +1,47 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestResolvePath(t *testing.T) {
+	home, _ := os.UserHomeDir()
+	t.Setenv("FOTO_PHOTOS", "/data/photos")
+
+	assert.Equal(t, filepath.Join(home, "photos"), resolvePath("~/photos", "/site"))
+	assert.Equal(t, home, resolvePath("~", "/site"))
+	assert.Equal(t, "/data/photos/travel", resolvePath("$FOTO_PHOTOS/travel", "/site"))
+	assert.Equal(t, "/data/photos", resolvePath("${FOTO_PHOTOS}", "/site"))
+	assert.Equal(t, "/site/photos", resolvePath("photos", "/site"))
+	assert.Equal(t, "/photos", resolvePath("../photos", "/site"))
+	assert.Equal(t, "/photos", resolvePath("/photos/", "/site"))
+	assert.Equal(t, "/site/~photos", resolvePath("~photos", "/site"))
+	assert.Equal(t, "", resolvePath("", "/site"))
+}
+
+func TestResolveTheme(t *testing.T) {
+	tmp := t.TempDir()
+	_ = os.MkdirAll(filepath.Join(tmp, "themes", "mine"), 0755)
+
+	assert.Equal(t, filepath.Join(tmp, "themes", "mine"), resolveTheme("themes/mine", tmp))
+	assert.Equal(t, "default", resolveTheme("default", tmp))
+	assert.Equal(t, "", resolveTheme("", tmp))
+}
+
+func TestFileConfigRelativePaths(t *testing.T) {
+	tmp := t.TempDir()
+	path := filepath.Join(tmp, "foto.toml")
+	_ = os.WriteFile(path, []byte("[[section]]\nfolder = \"photos\"\n[others]\nfolders = [\"assets\"]\n"), 0644)
+
+	// Relative to the config file rather than the working directory
+	t.Chdir(os.TempDir())
+	cfg, err := LoadFileConfig(path)
+	assert.Nil(t, err)
+	assert.Equal(t, filepath.Join(tmp, "photos"), cfg.GetSectionMetadata()[0].Folder)
+	assert.Equal(t, []string{filepath.Join(tmp, "assets")}, cfg.GetOtherFolders())
+	assert.Equal(t, filepath.Join(tmp, "templates", "template.html"), cfg.GetPageOption().Template)
+}
@@ -0,0 +1,543 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/pelletier/go-toml/v2"
+	"github.com/pelletier/go-toml/v2/unstable"
+	"github.com/waynezhang/foto/internal/constants"
+	"github.com/waynezhang/foto/internal/files"
+	"github.com/waynezhang/foto/internal/images"
+	"github.com/waynezhang/foto/internal/libraries"
+	"github.com/waynezhang/foto/internal/theme"
+)
+
+// Problem found by `Validate`, at `Line` of `File` when known
+type Problem struct {
+	File    string
+	Line    int
+	Message string
+	// Reported without failing the check
+	Warning bool
+}
+
+func (p Problem) String() string {
+	if p.Line > 0 {
+		return fmt.Sprintf("%s:%d: %s", p.File, p.Line, p.Message)
+	}
+	return fmt.Sprintf("%s: %s", p.File, p.Message)
+}
+
+// Keys of tables read by foto, matched case-insensitively. Other tables such as `[site]` belong to templates.
+var knownKeys = map[string][]string{
+	"image":     append(fieldNames(ExtractOption{}), "sizes"),
+	"section":   fieldNames(SectionMetadata{}),
+	"pages":     slices.DeleteFunc(fieldNames(PageOption{}), func(key string) bool { return key == "theme" }),
+	"libraries": fieldNames(LibraryOption{}),
+	"others":    {"folders", "show_foto_footer"},
+}
+
+// Keys outside of tables read by foto
+var topLevelKeys = []string{"theme"}
+
+// File describing a sub-album, read by the indexer
+const albumMetadataFileName = "album.toml"
+
+// Checks the config file and the file of `Environment` for syntax errors, unknown keys, values
+// out of range, duplicated slugs and missing folders, templates or themes. Problems are ordered by line.
+func Validate(file string) []Problem {
+	paths := []string{file}
+	if envFile := EnvironmentFile(file); envFile != "" && files.IsExisting(envFile) {
+		paths = append(paths, envFile)
+	}
+
+	v := &validator{}
+	themeName := ""
+	for _, path := range paths {
+		l, values, problem := readLayer(path)
+		if problem != nil {
+			return []Problem{*problem}
+		}
+		v.layers = append(v.layers, l)
+		if name, ok := values["theme"].(string); ok {
+			themeName = name
+		}
+	}
+	v.checkKeys()
+
+	// Theme defaults are loaded with the config
+	if themeName != "" {
+		if _, err := theme.Load(resolveTheme(themeName, baseDirectory(file))); err != nil {
+			v.add("theme", "%v", err)
+			return v.sorted()
+		}
+	}
+
+	cfg, err := LoadFileConfig(file)
+	if err != nil {
+		v.add("", "%v", err)
+		return v.sorted()
+	}
+
+	v.checkExtractOption(cfg.GetExtractOption())
+	v.checkSections(cfg.GetSectionMetadata())
+	v.checkOtherFolders(cfg.GetOtherFolders())
+	v.checkPages(cfg.GetPageOption())
+	v.checkPageSizes(cfg.GetSectionMetadata(), cfg.GetPageOption())
+	v.checkReservedSlugs(cfg.GetSectionMetadata(), cfg.GetPageOption(), cfg.GetOtherFolders())
+	v.checkLibraries(cfg.GetLibraryOption())
+
+	return v.sorted()
+}
+
+// A config file with the lines of its tables and keys
+type layer struct {
+	file string
+	// As written, e.g. `image`, `image.thumbnailWidth` and `section[1].slug`
+	keys map[string]int
+	// Same as `keys` but lowercased
+	lines map[string]int
+	// Top-level keys holding tables or arrays of tables, lowercased
+	tables map[string]bool
+}
+
+func readLayer(file string) (layer, map[string]any, *Problem) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return layer{}, nil, &Problem{File: file, Message: err.Error()}
+	}
+
+	values := map[string]any{}
+	var decodeErr *toml.DecodeError
+	if err := toml.Unmarshal(data, &values); errors.As(err, &decodeErr) {
+		line, _ := decodeErr.Position()
+		return layer{}, nil, &Problem{File: file, Line: line, Message: decodeErr.Error()}
+	} else if err != nil {
+		return layer{}, nil, &Problem{File: file, Message: err.Error()}
+	}
+
+	l := layer{file: file, keys: keyLines(data), lines: map[string]int{}, tables: map[string]bool{}}
+	for key, line := range l.keys {
+		l.lines[strings.ToLower(key)] = line
+	}
+	for key, value := range values {
+		if isTable(value) {
+			l.tables[strings.ToLower(key)] = true
+		}
+	}
+	return l, values, nil
+}
+
+type validator struct {
+	// The config file followed by the file overriding it
+	layers   []layer
+	problems []Problem
+}
+
+func (v *validator) add(key string, format string, a ...any) {
+	file, line := v.locate(key)
+	v.problems = append(v.problems, Problem{File: file, Line: line, Message: fmt.Sprintf(format, a...)})
+}
+
+// Same as `add` for problems that don't fail the check
+func (v *validator) warn(key string, format string, a ...any) {
+	v.add(key, format, a...)
+	v.problems[len(v.problems)-1].Warning = true
+}
+
+// File and line of `key`, preferring the file overriding it, falling back to its table
+// when the key is in no file
+func (v *validator) locate(key string) (string, int) {
+	key = strings.ToLower(key)
+	for key != "" {
+		for i := len(v.layers) - 1; i >= 0; i-- {
+			if line, ok := v.layers[i].lines[key]; ok {
+				return v.layers[i].file, line
+			}
+		}
+		i := strings.LastIndex(key, ".")
+		if i < 0 {
+			break
+		}
+		key = key[:i]
+	}
+	return v.layers[0].file, 0
+}
+
+func (v *validator) line(key string) int {
+	_, line := v.locate(key)
+	return line
+}
+
+func (v *validator) sorted() []Problem {
+	sort.SliceStable(v.problems, func(i, j int) bool {
+		a, b := v.problems[i].File, v.problems[j].File
+		if a != b {
+			if v.layerIndex(a) != v.layerIndex(b) {
+				return v.layerIndex(a) < v.layerIndex(b)
+			}
+			return a < b
+		}
+		return v.problems[i].Line < v.problems[j].Line
+	})
+	return v.problems
+}
+
+func (v *validator) layerIndex(file string) int {
+	for i, l := range v.layers {
+		if l.file == file {
+			return i
+		}
+	}
+	// e.g. album files, after the config files
+	return len(v.layers)
+}
+
+func (v *validator) checkKeys() {
+	for _, l := range v.layers {
+		v.checkLayerKeys(l)
+	}
+}
+
+func (v *validator) checkLayerKeys(l layer) {
+	for key := range l.keys {
+		table, name, ok := strings.Cut(key, ".")
+		if !ok {
+			if !strings.Contains(key, "[") && !l.tables[strings.ToLower(key)] {
+				v.checkTopLevelKey(key)
+			}
+			continue
+		}
+		// `section[1]` is the second `[[section]]`
+		if i := strings.Index(table, "["); i >= 0 {
+			table = table[:i]
+		}
+
+		known, checked := knownKeys[strings.ToLower(table)]
+		if !checked || slices.ContainsFunc(known, func(k string) bool { return strings.EqualFold(k, name) }) {
+			continue
+		}
+
+		message := fmt.Sprintf("Unknown key %s in [%s]", name, table)
+		if suggestion := closest(name, known); suggestion != "" {
+			message += fmt.Sprintf(", did you mean %s?", suggestion)
+		}
+		v.add(key, "%s", message)
+	}
+}
+
+func (v *validator) checkTopLevelKey(key string) {
+	if slices.ContainsFunc(topLevelKeys, func(k string) bool { return strings.EqualFold(k, key) }) {
+		return
+	}
+
+	message := fmt.Sprintf("Unknown top-level key %s", key)
+	if suggestion := closest(key, topLevelKeys); suggestion != "" {
+		message += fmt.Sprintf(", did you mean %s?", suggestion)
+	}
+	v.add(key, "%s", message)
+}
+
+func (v *validator) checkExtractOption(option ExtractOption) {
+	if option.ThumbnailWidth <= 0 {
+		v.add("image.thumbnailwidth", "thumbnailWidth of [image] needs to be positive, got %d", option.ThumbnailWidth)
+	}
+	if option.OriginalWidth <= 0 {
+		v.add("image.originalwidth", "originalWidth of [image] needs to be positive, got %d", option.OriginalWidth)
+	}
+	if option.MinThumbnailHeight < 0 {
+		v.add("image.minthumbnailheight", "minThumbnailHeight of [image] can't be negative, got %d", option.MinThumbnailHeight)
+	}
+	if option.MinOriginalHeight < 0 {
+		v.add("image.minoriginalheight", "minOriginalHeight of [image] can't be negative, got %d", option.MinOriginalHeight)
+	}
+	if option.CompressQuality < 1 || option.CompressQuality > 100 {
+		v.add("image.compressquality", "compressQuality of [image] needs to be between 1 and 100, got %d", option.CompressQuality)
+	}
+	for _, width := range option.ThumbnailWidths {
+		if width <= 0 {
+			v.add("image.thumbnailwidths", "thumbnailWidths of [image] need to be positive, got %d", width)
+		}
+	}
+	if _, err := images.ParseFormats(option.Formats); err != nil {
+		v.add("image.formats", "formats of [image] are invalid (%v), supported formats are jpeg, png, webp and avif", err)
+	}
+}
+
+func (v *validator) checkSections(sections []SectionMetadata) {
+	slugs := map[string]int{}
+	for i, s := range sections {
+		key := func(name string) string {
+			return fmt.Sprintf("section[%d].%s", i, name)
+		}
+		name := fmt.Sprintf("section \"%s\"", s.Title)
+
+		if s.Slug == "" {
+			v.add(key("slug"), "slug of %s is missing", name)
+		} else if !ValidSlug(s.Slug) {
+			v.add(key("slug"), "slug \"%s\" of %s is invalid, only letters, numbers, underscore(_) and hyphen(-) can be used", s.Slug, name)
+		} else if first, ok := slugs[s.Slug]; ok {
+			v.add(key("slug"), "slug \"%s\" of %s is already used by the section at line %d", s.Slug, name, v.line(fmt.Sprintf("section[%d].slug", first)))
+		} else {
+			slugs[s.Slug] = i
+		}
+
+		if s.Folder == "" {
+			v.add(key("folder"), "folder of %s is missing", name)
+		} else if !isDirectory(s.Folder) {
+			v.add(key("folder"), "folder %s of %s is not found", s.Folder, name)
+		} else if s.TextFile != "" {
+			path := s.TextFile
+			if !filepath.IsAbs(path) {
+				path = filepath.Join(s.Folder, path)
+			}
+			if !files.IsExisting(path) {
+				v.add(key("textfile"), "textFile %s of %s is not found", path, name)
+			}
+		}
+		if s.SubAlbums && isDirectory(s.Folder) {
+			v.checkAlbums(s.Folder)
+		}
+
+		if !ValidSort(s.Sort) {
+			v.add(key("sort"), "sort \"%s\" of %s is invalid, supported values are filename, mtime, manual and exif:<tag>", s.Sort, name)
+		}
+
+		for field, value := range map[string]int{
+			"thumbnailWidth":     s.ThumbnailWidth,
+			"minThumbnailHeight": s.MinThumbnailHeight,
+			"originalWidth":      s.OriginalWidth,
+			"minOriginalHeight":  s.MinOriginalHeight,
+			"pageSize":           s.PageSize,
+		} {
+			if value < 0 {
+				v.add(key(strings.ToLower(field)), "%s of %s can't be negative, got %d", field, name, value)
+			}
+		}
+		for _, width := range s.ThumbnailWidths {
+			if width <= 0 {
+				v.add(key("thumbnailwidths"), "thumbnailWidths of %s need to be positive, got %d", name, width)
+			}
+		}
+	}
+}
+
+// Checks slugs in the album files of the sub-albums in `folder`, reported at the lines of the album files
+func (v *validator) checkAlbums(folder string) {
+	_ = filepath.WalkDir(folder, func(path string, d os.DirEntry, err error) error {
+		if err != nil || !d.IsDir() || path == folder {
+			return nil
+		}
+		// Hidden folders are no sub-albums
+		if strings.HasPrefix(d.Name(), ".") {
+			return filepath.SkipDir
+		}
+
+		albumFile := filepath.Join(path, albumMetadataFileName)
+		if !files.IsExisting(albumFile) {
+			return nil
+		}
+		l, values, problem := readLayer(albumFile)
+		if problem != nil {
+			v.problems = append(v.problems, *problem)
+			return nil
+		}
+		if slug, ok := values["slug"].(string); ok && slug != "" && !ValidSlug(slug) {
+			v.problems = append(v.problems, Problem{
+				File:    albumFile,
+				Line:    l.lines["slug"],
+				Message: fmt.Sprintf("slug \"%s\" of album %s is invalid, only letters, numbers, underscore(_) and hyphen(-) can be used", slug, path),
+			})
+		}
+		return nil
+	})
+}
+
+func (v *validator) checkOtherFolders(folders []string) {
+	for _, folder := range folders {
+		if !isDirectory(folder) {
+			v.add("others.folders", "folder %s in [others] is not found", folder)
+		}
+	}
+}
+
+func (v *validator) checkLibraries(option LibraryOption) {
+	if !option.Local {
+		return
+	}
+	if missing := libraries.Missing(); len(missing) > 0 {
+		v.add("libraries.local", "local libraries %s are not bundled with this build of foto, run scripts/vendor before building it or add them to the vendor folder of the site", strings.Join(missing, ", "))
+	}
+}
+
+func (v *validator) checkPages(option PageOption) {
+	t, err := theme.Load(option.Theme)
+	if err != nil {
+		v.add("theme", "%v", err)
+		return
+	}
+
+	keys := []string{"template"}
+	templates := []string{option.Template}
+	if option.MultiPage {
+		keys = []string{"indextemplate", "sectiontemplate"}
+		templates = []string{option.IndexTemplate, option.SectionTemplate}
+	}
+	for i, path := range templates {
+		if _, err := t.Template(path, nil); err != nil {
+			v.add("pages."+keys[i], "template %s is invalid (%v)", path, err)
+		}
+	}
+}
+
+// Sections are only paginated on their own pages
+func (v *validator) checkPageSizes(sections []SectionMetadata, option PageOption) {
+	if option.MultiPage {
+		return
+	}
+	for i, s := range sections {
+		if s.PageSize > 0 {
+			v.warn(fmt.Sprintf("section[%d].pagesize", i), "pageSize of section \"%s\" is ignored without multiPage in [pages]", s.Title)
+		}
+	}
+}
+
+// Section pages of multi-page sites are folders in the output root, next to photos, libraries,
+// static files of the theme and other folders, and served by preview at the same paths
+func (v *validator) checkReservedSlugs(sections []SectionMetadata, option PageOption, otherFolders []string) {
+	if !option.MultiPage {
+		return
+	}
+
+	reserved := map[string]string{
+		strings.Trim(constants.PhotosURLPath, "/"): "photos",
+		libraries.DirectoryName:                    "libraries",
+	}
+	if t, err := theme.Load(option.Theme); err == nil && t.Static() != nil {
+		entries, _ := fs.ReadDir(t.Static(), ".")
+		for _, e := range entries {
+			reserved[e.Name()] = "static files of the theme"
+		}
+	}
+	for _, folder := range otherFolders {
+		reserved[filepath.Base(folder)] = "folders in [others]"
+	}
+
+	for i, s := range sections {
+		if usage, ok := reserved[s.Slug]; ok {
+			v.add(fmt.Sprintf("section[%d].slug", i), "slug \"%s\" of section \"%s\" is reserved for %s in multi-page sites", s.Slug, s.Title, usage)
+		}
+	}
+}
+
+// Lines of the tables and keys in a TOML document, keyed by dotted paths
+func keyLines(data []byte) map[string]int {
+	lines := map[string]int{}
+	arrays := map[string]int{}
+	current := ""
+
+	p := unstable.Parser{}
+	p.Reset(data)
+	for p.NextExpression() {
+		e := p.Expression()
+		switch e.Kind {
+		case unstable.Table:
+			current = joinKey(e.Key())
+			lines[current] = keyLine(&p, e)
+		case unstable.ArrayTable:
+			name := joinKey(e.Key())
+			current = fmt.Sprintf("%s[%d]", name, arrays[name])
+			arrays[name]++
+			lines[current] = keyLine(&p, e)
+		case unstable.KeyValue:
+			key := joinKey(e.Key())
+			if current != "" {
+				key = current + "." + key
+			}
+			lines[key] = keyLine(&p, e)
+		}
+	}
+	return lines
+}
+
+func joinKey(it unstable.Iterator) string {
+	parts := []string{}
+	for it.Next() {
+		parts = append(parts, string(it.Node().Data))
+	}
+	return strings.Join(parts, ".")
+}
+
+func keyLine(p *unstable.Parser, e *unstable.Node) int {
+	it := e.Key()
+	if !it.Next() {
+		return 0
+	}
+	return p.Shape(it.Node().Raw).Start.Line
+}
+
+// Names of struct fields as written in config files, e.g. `thumbnailWidth`
+func fieldNames(v any) []string {
+	t := reflect.TypeOf(v)
+	names := []string{}
+	for i := range t.NumField() {
+		name := t.Field(i).Name
+		names = append(names, strings.ToLower(name[:1])+name[1:])
+	}
+	return names
+}
+
+// The candidate within 2 edits of `name`, for typos such as `thumbnailwidht`
+func closest(name string, candidates []string) string {
+	best, bestDistance := "", 3
+	for _, c := range candidates {
+		if d := editDistance(strings.ToLower(name), strings.ToLower(c)); d < bestDistance {
+			best, bestDistance = c, d
+		}
+	}
+	return best
+}
+
+func editDistance(a string, b string) int {
+	prev := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		curr := make([]int, len(b)+1)
+		curr[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			curr[j] = min(prev[j]+1, curr[j-1]+1, prev[j-1]+cost)
+		}
+		prev = curr
+	}
+	return prev[len(b)]
+}
+
+// Whether a decoded TOML value is a table or an array of tables
+func isTable(value any) bool {
+	switch value := value.(type) {
+	case map[string]any:
+		return true
+	case []any:
+		return len(value) > 0 && isTable(value[0])
+	}
+	return false
+}
+
+func isDirectory(path string) bool {
+	info, err := os.Stat(path)
+	return err == nil && info.IsDir()
+}
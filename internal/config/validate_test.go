@@ -0,0 +1,298 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/waynezhang/foto/internal/libraries"
+)
+
+func writeConfig(t *testing.T, content string) string {
+	tmp := t.TempDir()
+	t.Chdir(tmp)
+	_ = os.MkdirAll(filepath.Join(tmp, "photos"), 0755)
+	_ = os.MkdirAll(filepath.Join(tmp, "assets"), 0755)
+
+	path := filepath.Join(tmp, "foto.toml")
+	_ = os.WriteFile(path, []byte(content), 0644)
+	return path
+}
+
+func messages(problems []Problem) []string {
+	m := []string{}
+	for _, p := range problems {
+		m = append(m, p.String())
+	}
+	return m
+}
+
+const validConfig = `theme = "default"
+
+[site]
+title = "Site"
+anything = "goes"
+
+[image]
+thumbnailWidth = 640
+originalWidth = 2048
+sizes = "100vw"
+
+[[section]]
+title = "Section 1"
+slug = "section-1"
+folder = "photos"
+
+[others]
+folders = ["assets"]
+`
+
+func TestValidate(t *testing.T) {
+	path := writeConfig(t, validConfig)
+	assert.Empty(t, Validate(path))
+}
+
+func TestValidateUnknownKeys(t *testing.T) {
+	path := writeConfig(t, validConfig+`
+[pages]
+multipage = true
+indexTemplat = "index.html"
+`)
+	path2 := filepath.Join(filepath.Dir(path), "foto2.toml")
+	data, _ := os.ReadFile(path)
+	_ = os.WriteFile(path2, []byte(string(data)+"\n[libraries]\nlocal = false\nremote = false\n"), 0644)
+
+	assert.Equal(t, []string{
+		path + ":22: Unknown key indexTemplat in [pages], did you mean indexTemplate?",
+	}, messages(Validate(path)))
+
+	problems := Validate(path2)
+	assert.Equal(t, 2, len(problems))
+	assert.Equal(t, 26, problems[1].Line)
+	assert.Equal(t, "Unknown key remote in [libraries]", problems[1].Message)
+}
+
+func TestValidateRanges(t *testing.T) {
+	path := writeConfig(t, `theme = "default"
+[image]
+thumbnailWidht = 640
+originalWidth = 2048
+compressQuality = 101
+thumbnailWidths = [320, -1]
+
+[[section]]
+title = "Section 1"
+slug = "section-1"
+folder = "photos"
+pageSize = -1
+`)
+
+	assert.Equal(t, []string{
+		path + ":2: thumbnailWidth of [image] needs to be positive, got 0",
+		path + ":3: Unknown key thumbnailWidht in [image], did you mean thumbnailWidth?",
+		path + ":5: compressQuality of [image] needs to be between 1 and 100, got 101",
+		path + ":6: thumbnailWidths of [image] need to be positive, got -1",
+		path + ":12: pageSize of section \"Section 1\" can't be negative, got -1",
+	}, messages(Validate(path)))
+}
+
+func TestValidateSections(t *testing.T) {
+	path := writeConfig(t, `theme = "default"
+[image]
+thumbnailWidth = 640
+originalWidth = 2048
+
+[[section]]
+title = "Section 1"
+slug = "section"
+folder = "photos"
+textFile = "missing.md"
+
+[[section]]
+title = "Section 2"
+slug = "section"
+folder = "missing"
+
+[others]
+folders = ["assets", "media"]
+`)
+
+	dir := filepath.Dir(path)
+	assert.Equal(t, []string{
+		path + ":10: textFile " + filepath.Join(dir, "photos", "missing.md") + " of section \"Section 1\" is not found",
+		path + ":14: slug \"section\" of section \"Section 2\" is already used by the section at line 8",
+		path + ":15: folder " + filepath.Join(dir, "missing") + " of section \"Section 2\" is not found",
+		path + ":18: folder " + filepath.Join(dir, "media") + " in [others] is not found",
+	}, messages(Validate(path)))
+}
+
+func TestValidateTemplates(t *testing.T) {
+	path := writeConfig(t, `theme = "missing"
+`)
+	problems := Validate(path)
+	assert.Equal(t, 1, len(problems))
+	assert.Equal(t, 1, problems[0].Line)
+
+	path = writeConfig(t, validConfig[len(`theme = "default"`):]+`
+[pages]
+multiPage = true
+indexTemplate = "templates/missing.html"
+`)
+	problems = Validate(path)
+	assert.Equal(t, 2, len(problems))
+	// Falls back to the line of [pages] for templates not in the file
+	assert.Contains(t, problems[0].Message, "templates/section.html")
+	assert.Contains(t, problems[1].Message, "templates/missing.html")
+}
+
+func TestValidateInvalidFile(t *testing.T) {
+	path := writeConfig(t, "[image]\nthumbnailWidth = \n")
+	problems := Validate(path)
+	assert.Equal(t, 1, len(problems))
+	assert.Equal(t, 2, problems[0].Line)
+
+	path = writeConfig(t, "[image]\nthumbnailWidth = \"wide\"\n")
+	problems = Validate(path)
+	assert.Equal(t, 1, len(problems))
+	assert.Contains(t, problems[0].Message, "image")
+
+	problems = Validate("not-existing.toml")
+	assert.Equal(t, 1, len(problems))
+}
+
+func TestClosest(t *testing.T) {
+	assert.Equal(t, "thumbnailWidth", closest("thumbnailwidht", []string{"originalWidth", "thumbnailWidth"}))
+	assert.Equal(t, "", closest("colour", []string{"originalWidth", "thumbnailWidth"}))
+}
+
+func TestValidateEnvironment(t *testing.T) {
+	path := writeConfig(t, validConfig)
+	envPath := filepath.Join(filepath.Dir(path), "foto.production.toml")
+	_ = os.WriteFile(envPath, []byte("[image]\ncompressQuality = 101\nthumbnailWidht = 320\n"), 0644)
+
+	useEnvironment(t, "production")
+	assert.Equal(t, []string{
+		envPath + ":2: compressQuality of [image] needs to be between 1 and 100, got 101",
+		envPath + ":3: Unknown key thumbnailWidht in [image], did you mean thumbnailWidth?",
+	}, messages(Validate(path)))
+}
+
+func TestValidateLocalLibraries(t *testing.T) {
+	path := writeConfig(t, validConfig+"\n[libraries]\nlocal = true\n")
+
+	problems := Validate(path)
+	if len(libraries.Missing()) == 0 {
+		assert.Empty(t, problems)
+		return
+	}
+	assert.Equal(t, 1, len(problems))
+	assert.Equal(t, 21, problems[0].Line)
+	assert.Contains(t, problems[0].Message, "not bundled")
+
+	// The vendor folder of the site
+	_ = os.MkdirAll(filepath.Join(filepath.Dir(path), libraries.DirectoryName), 0755)
+	assert.Empty(t, Validate(path))
+}
+
+func TestValidateValues(t *testing.T) {
+	path := writeConfig(t, `thme = "default"
+[image]
+thumbnailWidth = 640
+originalWidth = 2048
+formats = ["gif"]
+
+[[section]]
+title = "Section 1"
+slug = "section 1"
+folder = "photos"
+sort = "date"
+subAlbums = true
+
+[others]
+folders = ["assets"]
+show_foto_footer = true
+colour = "red"
+`)
+	dir := filepath.Dir(path)
+	album := filepath.Join(dir, "photos", "sub")
+	_ = os.MkdirAll(album, 0755)
+	_ = os.WriteFile(filepath.Join(album, "album.toml"), []byte("title = \"Sub\"\nslug = \"My Sub/../x\"\n"), 0644)
+	// Hidden folders are no sub-albums
+	_ = os.MkdirAll(filepath.Join(dir, "photos", ".hidden"), 0755)
+	_ = os.WriteFile(filepath.Join(dir, "photos", ".hidden", "album.toml"), []byte("slug = \"a/b\"\n"), 0644)
+
+	problems := messages(Validate(path))
+	// Templates of the site are missing without a theme
+	assert.Contains(t, problems[0], "templates/template.html")
+	assert.Equal(t, []string{
+		path + ":1: Unknown top-level key thme, did you mean theme?",
+		path + ":5: formats of [image] are invalid (unsupported output format: gif), supported formats are jpeg, png, webp and avif",
+		path + ":9: slug \"section 1\" of section \"Section 1\" is invalid, only letters, numbers, underscore(_) and hyphen(-) can be used",
+		path + ":11: sort \"date\" of section \"Section 1\" is invalid, supported values are filename, mtime, manual and exif:<tag>",
+		path + ":17: Unknown key colour in [others]",
+		filepath.Join(album, "album.toml") + ":2: slug \"My Sub/../x\" of album " + album + " is invalid, only letters, numbers, underscore(_) and hyphen(-) can be used",
+	}, problems[1:])
+}
+
+func TestValidatePageSizeWithoutMultiPage(t *testing.T) {
+	path := writeConfig(t, validConfig+`
+[[section]]
+title = "Section 2"
+slug = "section-2"
+folder = "photos"
+pageSize = 100
+`)
+
+	problems := Validate(path)
+	assert.Equal(t, 1, len(problems))
+	assert.True(t, problems[0].Warning)
+	assert.Equal(t, path+":24: pageSize of section \"Section 2\" is ignored without multiPage in [pages]", problems[0].String())
+
+	path = writeConfig(t, validConfig+`
+[pages]
+multiPage = true
+
+[[section]]
+title = "Section 2"
+slug = "section-2"
+folder = "photos"
+pageSize = 100
+`)
+	assert.Empty(t, Validate(path))
+}
+
+func TestValidateReservedSlugs(t *testing.T) {
+	sections := `
+[[section]]
+title = "Photos"
+slug = "photos"
+folder = "photos"
+
+[[section]]
+title = "Vendor"
+slug = "vendor"
+folder = "photos"
+
+[[section]]
+title = "Theme"
+slug = "theme"
+folder = "photos"
+
+[[section]]
+title = "Assets"
+slug = "assets"
+folder = "photos"
+`
+	path := writeConfig(t, validConfig+"\n[pages]\nmultiPage = true\n"+sections)
+	assert.Equal(t, []string{
+		path + ":25: slug \"photos\" of section \"Photos\" is reserved for photos in multi-page sites",
+		path + ":30: slug \"vendor\" of section \"Vendor\" is reserved for libraries in multi-page sites",
+		path + ":35: slug \"theme\" of section \"Theme\" is reserved for static files of the theme in multi-page sites",
+		path + ":40: slug \"assets\" of section \"Assets\" is reserved for folders in [others] in multi-page sites",
+	}, messages(Validate(path)))
+
+	// Single pages don't have section folders
+	path = writeConfig(t, validConfig+sections)
+	assert.Empty(t, Validate(path))
+}
@@ -6,12 +6,16 @@ const (
 	PhotoSwipeVersion              = "5.4.4"
 	PhotoSwipeCaptionPluginVersion = "1.2.7"
 	CacheDirectoryName             = ".foto"
-	CacheVersion                   = "3"
+	CacheVersion                   = "4"
 
 	PhotosURLPath          string = "/photos/"
+	LiveReloadURLPath      string = "/__foto/livereload"
 	DefaultCompressQuality        = 75
 )
 
 var (
-	TemplateFilePath string = filepath.Join("templates", "template.html")
+	ConfigFilePath          string = "foto.toml"
+	TemplateFilePath        string = filepath.Join("templates", "template.html")
+	IndexTemplateFilePath   string = filepath.Join("templates", "index.html")
+	SectionTemplateFilePath string = filepath.Join("templates", "section.html")
 )
@@ -1,11 +1,11 @@
 package export
 
 import (
-	"html/template"
+	"fmt"
 	"io/fs"
 	"os"
 	"path/filepath"
-	"sync"
+	"strings"
 
 	cp "github.com/otiai10/copy"
 	"github.com/rs/zerolog/log"
@@ -14,8 +14,12 @@ import (
 	"github.com/waynezhang/foto/internal/files"
 	"github.com/waynezhang/foto/internal/images"
 	"github.com/waynezhang/foto/internal/indexer"
+	"github.com/waynezhang/foto/internal/libraries"
 	mm "github.com/waynezhang/foto/internal/minimize"
+	"github.com/waynezhang/foto/internal/pages"
+	"github.com/waynezhang/foto/internal/theme"
 	"github.com/waynezhang/foto/internal/utils"
+	"github.com/waynezhang/foto/internal/workers"
 )
 
 type defaultExportContext struct{}
@@ -24,8 +28,8 @@ func (ctx defaultExportContext) cleanDirectory(outputPath string) error {
 	return files.PruneDirectory(outputPath)
 }
 
-func (ctx defaultExportContext) buildIndex(cfg config.Config) ([]indexer.Section, error) {
-	return indexer.Build(cfg.GetSectionMetadata(), cfg.GetExtractOption())
+func (ctx defaultExportContext) buildIndex(cfg config.Config, cache cache.Cache) ([]indexer.Section, error) {
+	return indexer.Build(cfg.GetSectionMetadata(), cfg.GetExtractOption(), cache)
 }
 
 func (ctx defaultExportContext) exportPhotos(
@@ -39,13 +43,11 @@ func (ctx defaultExportContext) exportPhotos(
 		return
 	}
 
-	wg := &sync.WaitGroup{}
+	g := workers.Shared().Group()
 
-	for _, s := range sections {
+	for _, s := range indexer.Flatten(sections) {
 		for _, set := range s.ImageSets {
-			srcPath := filepath.Join(s.Folder, set.FileName)
-
-			wg.Add(1)
+			srcPath := set.SourcePath(s.Folder)
 
 			slug := s.Slug
 			thumbnailWidth := set.ThumbnailSize.Width
@@ -53,44 +55,65 @@ func (ctx defaultExportContext) exportPhotos(
 			originalWidth := set.OriginalSize.Width
 			originalHeight := set.OriginalSize.Height
 			compressQuality := set.CompressQuality
-			go func() {
-				defer wg.Done()
+			variants := set.OutputVariants()
+			thumbnails := set.Thumbnails
+			g.Go(images.DecodedBytes(srcPath), func() {
+				// Decoded once for every rendition that isn't cached
+				src := images.OpenSource(srcPath)
+
+				for _, variant := range variants {
+					thumbnailPath := files.OutputPhotoThumbnailFilePath(outputPath, slug, variant.FileName)
+					err := resizeImageAndCache(src, thumbnailPath, thumbnailWidth, thumbnailHeight, compressQuality, variant.Format, cache)
+					utils.CheckFatalError(err, "Failed to generate thumbnail image")
 
-				thumbnailPath := files.OutputPhotoThumbnailFilePath(outputPath, slug, srcPath)
-				err := resizeImageAndCache(srcPath, thumbnailPath, thumbnailWidth, thumbnailHeight, compressQuality, cache)
-				utils.CheckFatalError(err, "Failed to generate thumbnail image")
+					originalPath := files.OutputPhotoOriginalFilePath(outputPath, slug, variant.FileName)
+					err = resizeImageAndCache(src, originalPath, originalWidth, originalHeight, compressQuality, variant.Format, cache)
+					utils.CheckFatalError(err, "Failed to generate original image")
 
-				originalPath := files.OutputPhotoOriginalFilePath(outputPath, slug, srcPath)
-				err = resizeImageAndCache(srcPath, originalPath, originalWidth, originalHeight, compressQuality, cache)
-				utils.CheckFatalError(err, "Failed to generate original image")
+					for _, thumbnail := range thumbnails {
+						path := files.OutputPhotoRenditionFilePath(outputPath, slug, thumbnail.Key, variant.FileName)
+						err = resizeImageAndCache(src, path, thumbnail.Size.Width, thumbnail.Size.Height, compressQuality, variant.Format, cache)
+						utils.CheckFatalError(err, "Failed to generate thumbnail image")
+					}
+				}
 
 				log.Debug().Msgf("Processing image %s", srcPath)
 				if postProgressFn != nil {
 					postProgressFn(srcPath)
 				}
-			}()
+			})
 		}
 	}
 
-	wg.Wait()
+	g.Wait()
+
+	// Cached images of deleted photos. Photos outside of this export, e.g. of sections missing
+	// from an environment, are kept for `foto cache prune`.
+	if _, err := cache.PruneSources(files.IsExisting); err != nil {
+		log.Warn().Msgf("Failed to prune cache (%v)", err)
+	}
+	if err := cache.Save(); err != nil {
+		log.Warn().Msgf("Failed to save cache (%v)", err)
+	}
 }
 
-func (ctx defaultExportContext) generateIndexHtml(cfg config.Config, templatePath string, sections []indexer.Section, path string, minimizer mm.Minimizer) {
-	f, err := os.Create(path)
+func (ctx defaultExportContext) generateIndexHtml(cfg config.Config, page pages.Page, sections []indexer.Section, path string, minimizer mm.Minimizer) {
+	err := files.EnsureParentDirectory(path)
 	utils.CheckFatalError(err, "Failed to create index file.")
-	defer f.Close()
-
-	tmpl := template.Must(template.ParseFiles(templatePath))
-	err = tmpl.Execute(f, struct {
-		Config   map[string]any
-		Sections []indexer.Section
-	}{
-		cfg.AllSettings(),
-		sections,
-	})
+
+	// Render to a temporary file so an unchanged index keeps its modification time
+	tmpPath := temporaryFilePath(path)
+	f, err := os.Create(tmpPath)
+	utils.CheckFatalError(err, "Failed to create index file.")
+
+	err = pages.Render(f, cfg, sections, page)
+	f.Close()
 	utils.CheckFatalError(err, "Failed to generate index page.")
 
-	_ = minimizer.MinimizeFile(path, path)
+	_ = minimizer.MinimizeFile(tmpPath, tmpPath)
+
+	err = files.MoveFileIfChanged(tmpPath, path)
+	utils.CheckFatalError(err, "Failed to write index file.")
 }
 
 func (ctx defaultExportContext) processOtherFolders(folders []string, outputPath string, minimizer mm.Minimizer, messageFunc func(src string, dst string)) {
@@ -100,34 +123,176 @@ func (ctx defaultExportContext) processOtherFolders(folders []string, outputPath
 			messageFunc(folder, targetFolder)
 		}
 
-		if err := cp.Copy(folder, targetFolder); err != nil {
+		if err := syncFolder(folder, targetFolder, minimizer); err != nil {
 			log.Error().Msgf("Failed to copy folder %s to %s (%s).", folder, targetFolder, err)
 		}
-		_ = filepath.WalkDir(targetFolder, func(path string, d fs.DirEntry, err error) error {
-			if minimizer.Minimizable(path) {
-				return minimizer.MinimizeFile(path, path)
+	}
+}
+
+func (ctx defaultExportContext) writeManifest(sections []indexer.Section, outputPath string) error {
+	return writeManifest(sections, outputPath)
+}
+
+func (ctx defaultExportContext) exportLibraries(outputPath string) error {
+	if missing := libraries.Missing(); len(missing) > 0 {
+		return fmt.Errorf("libraries %s are not bundled with this build of foto. Run scripts/vendor before building it, or add them to the vendor folder of the site.", strings.Join(missing, ", "))
+	}
+	return syncFS(libraries.Source(), filepath.Join(outputPath, libraries.DirectoryName))
+}
+
+func (ctx defaultExportContext) exportTheme(name string, outputPath string) error {
+	t, err := theme.Load(name)
+	if err != nil {
+		return err
+	}
+	if static := t.Static(); static != nil {
+		return syncFS(static, outputPath)
+	}
+	return nil
+}
+
+func (ctx defaultExportContext) removeOrphans(cfg config.Config, sections []indexer.Section, outputPath string) error {
+	pageList := pages.Build(cfg.GetPageOption(), sections)
+	expected := expectedOutputFiles(sections, pageList, cfg.GetOtherFolders(), outputPath)
+	if cfg.GetExtractOption().HashFileNames {
+		expected[filepath.Join(outputPath, manifestFileName)] = true
+	}
+	if cfg.GetLibraryOption().Local {
+		addFSFiles(expected, libraries.Source(), filepath.Join(outputPath, libraries.DirectoryName))
+	}
+	if t, err := theme.Load(cfg.GetPageOption().Theme); err == nil && t.Static() != nil {
+		addFSFiles(expected, t.Static(), outputPath)
+	}
+	return files.PruneDirectoryExcept(outputPath, expected)
+}
+
+// Write files of `fsys` into `to`, skipping files whose content is unchanged
+func syncFS(fsys fs.FS, to string) error {
+	return fs.WalkDir(fsys, ".", func(path string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+
+		data, err := fs.ReadFile(fsys, path)
+		if err != nil {
+			return err
+		}
+
+		target := filepath.Join(to, filepath.FromSlash(path))
+		tmpPath := temporaryFilePath(target)
+		if err := files.WriteDataToFile(data, tmpPath); err != nil {
+			return err
+		}
+		return files.MoveFileIfChanged(tmpPath, target)
+	})
+}
+
+// Add the paths files of `fsys` are written to by `syncFS` to `expected`
+func addFSFiles(expected map[string]bool, fsys fs.FS, to string) {
+	_ = fs.WalkDir(fsys, ".", func(path string, d fs.DirEntry, err error) error {
+		if err == nil && !d.IsDir() {
+			expected[filepath.Join(to, filepath.FromSlash(path))] = true
+		}
+		return nil
+	})
+}
+
+// Copy files of `folder` into `to`, skipping files whose content is unchanged
+func syncFolder(folder string, to string, minimizer mm.Minimizer) error {
+	return filepath.WalkDir(folder, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			return nil
+		}
+
+		rel, err := filepath.Rel(folder, path)
+		if err != nil {
+			return err
+		}
+		target := filepath.Join(to, rel)
+
+		tmpPath := temporaryFilePath(target)
+		if err := cp.Copy(path, tmpPath); err != nil {
+			return err
+		}
+		if minimizer.Minimizable(tmpPath) {
+			_ = minimizer.MinimizeFile(tmpPath, tmpPath)
+		}
+		return files.MoveFileIfChanged(tmpPath, target)
+	})
+}
+
+// Temporary path next to `path`, keeping the extension so minimizers still recognize it
+func temporaryFilePath(path string) string {
+	return filepath.Join(filepath.Dir(path), ".tmp-"+filepath.Base(path))
+}
+
+// All files an export of `sections`, `pageList` and `otherFolders` writes into `outputPath`
+func expectedOutputFiles(sections []indexer.Section, pageList []pages.Page, otherFolders []string, outputPath string) map[string]bool {
+	expected := map[string]bool{}
+	add := func(path string) {
+		expected[filepath.Clean(path)] = true
+	}
+
+	for _, page := range pageList {
+		add(filepath.Join(outputPath, page.FilePath))
+	}
+
+	photosPath := files.OutputPhotosFilePath(outputPath)
+	for _, s := range indexer.Flatten(sections) {
+		for _, set := range s.ImageSets {
+			for _, variant := range set.OutputVariants() {
+				add(files.OutputPhotoThumbnailFilePath(photosPath, s.Slug, variant.FileName))
+				add(files.OutputPhotoOriginalFilePath(photosPath, s.Slug, variant.FileName))
+				for _, thumbnail := range set.Thumbnails {
+					add(files.OutputPhotoRenditionFilePath(photosPath, s.Slug, thumbnail.Key, variant.FileName))
+				}
+			}
+		}
+	}
+
+	for _, folder := range otherFolders {
+		targetFolder := filepath.Join(outputPath, filepath.Base(folder))
+		_ = filepath.WalkDir(folder, func(path string, d fs.DirEntry, err error) error {
+			if err != nil || d.IsDir() {
+				return nil
+			}
+			rel, err := filepath.Rel(folder, path)
+			if err == nil {
+				add(filepath.Join(targetFolder, rel))
 			}
 			return nil
 		})
 	}
+
+	return expected
 }
 
-func resizeImageAndCache(src string, to string, width int, height int, compressQuality int, cache cache.Cache) error {
-	cached := cache.CachedImage(src, width, height, compressQuality)
+func resizeImageAndCache(src *images.Source, to string, width int, height int, compressQuality int, format images.Format, cache cache.Cache) error {
+	cached := cache.CachedImage(src.Path, width, height, compressQuality, format)
 	if cached != nil {
-		log.Debug().Msgf("Found cached image for %s", src)
+		log.Debug().Msgf("Found cached image for %s", src.Path)
+		if files.IsSameContent(*cached, to) {
+			log.Debug().Msgf("Skipped unchanged image %s", to)
+			return nil
+		}
 		err := cp.Copy(*cached, to)
 		if err == nil {
 			return nil
 		}
 	}
 
-	err := images.ResizeImage(src, to, width, height, compressQuality)
+	// Rendered next to `to` first so an unchanged output keeps its modification time with a cold cache
+	tmp := temporaryFilePath(to)
+	err := src.Resize(tmp, width, height, compressQuality, format)
 	if err != nil {
+		_ = os.Remove(tmp)
 		return err
 	}
 
-	cache.AddImage(src, width, height, compressQuality, to)
+	cache.AddImage(src.Path, width, height, compressQuality, format, tmp)
 
-	return nil
+	return files.MoveFileIfChanged(tmp, to)
 }
@@ -2,25 +2,27 @@ package export
 
 import (
 	"fmt"
+	"path/filepath"
 
 	"github.com/chelnak/ysmrr"
 	"github.com/chelnak/ysmrr/pkg/animations"
 	"github.com/rs/zerolog/log"
 	"github.com/waynezhang/foto/internal/cache"
 	"github.com/waynezhang/foto/internal/config"
-	"github.com/waynezhang/foto/internal/constants"
 	"github.com/waynezhang/foto/internal/files"
 	"github.com/waynezhang/foto/internal/indexer"
 	mm "github.com/waynezhang/foto/internal/minimize"
+	"github.com/waynezhang/foto/internal/pages"
 	"github.com/waynezhang/foto/internal/utils"
 )
 
-func Export(outputPath string, minimize bool) {
+func Export(outputPath string, minimize bool, incremental bool) {
 	export(
 		config.Shared(),
 		outputPath,
 		minimizer(minimize),
 		cache.Shared(),
+		incremental,
 		new(defaultExportContext),
 	)
 }
@@ -29,7 +31,7 @@ type progressFunc func(path string)
 
 type context interface {
 	cleanDirectory(outputPath string) error
-	buildIndex(cfg config.Config) ([]indexer.Section, error)
+	buildIndex(cfg config.Config, cache cache.Cache) ([]indexer.Section, error)
 	exportPhotos(
 		sections []indexer.Section,
 		outputPath string,
@@ -38,7 +40,7 @@ type context interface {
 	)
 	generateIndexHtml(
 		cfg config.Config,
-		templatePath string,
+		page pages.Page,
 		sections []indexer.Section,
 		path string,
 		minimizer mm.Minimizer,
@@ -49,6 +51,17 @@ type context interface {
 		minimizer mm.Minimizer,
 		messageFunc func(src string, dst string),
 	)
+	writeManifest(
+		sections []indexer.Section,
+		outputPath string,
+	) error
+	exportLibraries(outputPath string) error
+	exportTheme(name string, outputPath string) error
+	removeOrphans(
+		cfg config.Config,
+		sections []indexer.Section,
+		outputPath string,
+	) error
 }
 
 func export(
@@ -56,6 +69,7 @@ func export(
 	outputPath string,
 	minimizer mm.Minimizer,
 	cache cache.Cache,
+	incremental bool,
 	ctx context,
 ) {
 	sm := ysmrr.NewSpinnerManager(
@@ -69,17 +83,22 @@ func export(
 		spinner.UpdateMessagef(prefixSpinnerMsg+format, a...)
 	}
 
-	spinnerMsg("removing directory %s", outputPath)
-	err := ctx.cleanDirectory(outputPath)
-	if err != nil {
-		utils.CheckFatalError(err, "Failed to remove directory.")
+	if !incremental {
+		spinnerMsg("removing directory %s", outputPath)
+		err := ctx.cleanDirectory(outputPath)
+		if err != nil {
+			utils.CheckFatalError(err, "Failed to remove directory.")
+		}
 	}
 
 	spinnerMsg("building index")
 	photosDirectory := files.OutputPhotosFilePath(outputPath)
-	section, err := ctx.buildIndex(cfg)
+	section, err := ctx.buildIndex(cfg, cache)
 	if err != nil {
-		_ = ctx.cleanDirectory(outputPath)
+		// Keep the previous output in incremental mode
+		if !incremental {
+			_ = ctx.cleanDirectory(outputPath)
+		}
 		utils.CheckFatalError(err, "Failed to build index.")
 	}
 
@@ -87,14 +106,41 @@ func export(
 		spinnerMsg("processed image %s", path)
 	})
 
-	indexPath := files.OutputIndexFilePath(outputPath)
-	log.Debug().Msgf("Exporting photos to %s", indexPath)
-	ctx.generateIndexHtml(cfg, constants.TemplateFilePath, section, indexPath, minimizer)
+	for _, page := range pages.Build(cfg.GetPageOption(), section) {
+		pagePath := filepath.Join(outputPath, page.FilePath)
+		log.Debug().Msgf("Generating page %s", pagePath)
+		spinnerMsg("generating page %s", page.FilePath)
+		ctx.generateIndexHtml(cfg, page, section, pagePath, minimizer)
+	}
+
+	if cfg.GetExtractOption().HashFileNames {
+		spinnerMsg("writing manifest")
+		err = ctx.writeManifest(section, outputPath)
+		utils.CheckFatalError(err, "Failed to write manifest.")
+	}
 
 	ctx.processOtherFolders(cfg.GetOtherFolders(), outputPath, minimizer, func(src string, dst string) {
 		spinnerMsg("copying folder %s to %s", src, dst)
 	})
 
+	if name := cfg.GetPageOption().Theme; name != "" {
+		spinnerMsg("copying theme %s", name)
+		err = ctx.exportTheme(name, outputPath)
+		utils.CheckFatalError(err, "Failed to copy theme.")
+	}
+
+	if cfg.GetLibraryOption().Local {
+		spinnerMsg("copying libraries")
+		err = ctx.exportLibraries(outputPath)
+		utils.CheckFatalError(err, "Failed to copy libraries.")
+	}
+
+	if incremental {
+		spinnerMsg("removing orphaned files")
+		err = ctx.removeOrphans(cfg, section, outputPath)
+		utils.CheckFatalError(err, "Failed to remove orphaned files.")
+	}
+
 	spinner.UpdateMessage(prefixSpinnerMsg + "succeeded")
 
 	spinner.Complete()
@@ -1,10 +1,12 @@
 package export
 
 import (
+	"io/fs"
 	"os"
 	"path/filepath"
 	"reflect"
 	"testing"
+	"time"
 
 	"github.com/mitchellh/mapstructure"
 	"github.com/stretchr/testify/assert"
@@ -13,8 +15,11 @@ import (
 	"github.com/waynezhang/foto/internal/config"
 	"github.com/waynezhang/foto/internal/constants"
 	"github.com/waynezhang/foto/internal/files"
+	"github.com/waynezhang/foto/internal/images"
 	"github.com/waynezhang/foto/internal/indexer"
+	"github.com/waynezhang/foto/internal/libraries"
 	mm "github.com/waynezhang/foto/internal/minimize"
+	"github.com/waynezhang/foto/internal/pages"
 	"github.com/waynezhang/foto/internal/testdata"
 )
 
@@ -28,18 +33,57 @@ func (m *MockCache) Migrate() {
 	m.Called()
 }
 
-func (m *MockCache) AddImage(src string, width int, height int, compressQuality int, file string) {
-	m.Called(src, width, height, compressQuality, file)
+func (m *MockCache) AddImage(src string, width int, height int, compressQuality int, format images.Format, file string) {
+	m.Called(src, width, height, compressQuality, format, file)
 }
 
-func (m *MockCache) CachedImage(src string, width int, height int, compressQuality int) *string {
-	arg := m.Called(src, width, height, compressQuality).Get(0)
+func (m *MockCache) CachedImage(src string, width int, height int, compressQuality int, format images.Format) *string {
+	arg := m.Called(src, width, height, compressQuality, format).Get(0)
 	if arg == nil {
 		return nil
 	}
 	return arg.(*string)
 }
 
+func (m *MockCache) Checksum(src string) (*string, error) {
+	args := m.Called(src)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*string), args.Error(1)
+}
+
+func (m *MockCache) IndexRecord(src string) *cache.IndexRecord {
+	arg := m.Called(src).Get(0)
+	if arg == nil {
+		return nil
+	}
+	return arg.(*cache.IndexRecord)
+}
+
+func (m *MockCache) AddIndexRecord(src string, record cache.IndexRecord) {
+	m.Called(src, record)
+}
+
+func (m *MockCache) Save() error {
+	return m.Called().Error(0)
+}
+
+func (m *MockCache) Stats() (cache.Stats, error) {
+	args := m.Called()
+	return args.Get(0).(cache.Stats), args.Error(1)
+}
+
+func (m *MockCache) PruneToSize(maxBytes int64) (cache.PruneResult, error) {
+	args := m.Called(maxBytes)
+	return args.Get(0).(cache.PruneResult), args.Error(1)
+}
+
+func (m *MockCache) PruneSources(keep func(src string) bool) (cache.PruneResult, error) {
+	args := m.Called(keep)
+	return args.Get(0).(cache.PruneResult), args.Error(1)
+}
+
 func (m *MockCache) Clear() {
 	m.Called()
 }
@@ -60,6 +104,12 @@ func (m *MockConfig) GetOtherFolders() []string {
 func (m *MockConfig) GetExtractOption() config.ExtractOption {
 	return m.Called().Get(0).(config.ExtractOption)
 }
+func (m *MockConfig) GetPageOption() config.PageOption {
+	return m.Called().Get(0).(config.PageOption)
+}
+func (m *MockConfig) GetLibraryOption() config.LibraryOption {
+	return m.Called().Get(0).(config.LibraryOption)
+}
 func (m *MockConfig) AllSettings() map[string]any {
 	return m.Called().Get(0).(map[string]any)
 }
@@ -74,8 +124,8 @@ func (m *MockContext) cleanDirectory(outputPath string) error {
 	return m.Called(outputPath).Error(0)
 }
 
-func (m *MockContext) buildIndex(cfg config.Config) ([]indexer.Section, error) {
-	args := m.Called(cfg)
+func (m *MockContext) buildIndex(cfg config.Config, cache cache.Cache) ([]indexer.Section, error) {
+	args := m.Called(cfg, cache)
 	var sections []indexer.Section
 	var err error
 	if args.Get(0) != nil {
@@ -91,14 +141,30 @@ func (m *MockContext) exportPhotos(sections []indexer.Section, outputPath string
 	m.Called(sections, outputPath, cache, nil)
 }
 
-func (m *MockContext) generateIndexHtml(cfg config.Config, templatePath string, sections []indexer.Section, path string, minimizer mm.Minimizer) {
-	m.Called(cfg, templatePath, sections, path, minimizer)
+func (m *MockContext) generateIndexHtml(cfg config.Config, page pages.Page, sections []indexer.Section, path string, minimizer mm.Minimizer) {
+	m.Called(cfg, page, sections, path, minimizer)
 }
 
 func (m *MockContext) processOtherFolders(folders []string, outputPath string, minimizer mm.Minimizer, messageFunc func(src string, dst string)) {
 	m.Called(folders, outputPath, minimizer, nil)
 }
 
+func (m *MockContext) writeManifest(sections []indexer.Section, outputPath string) error {
+	return m.Called(sections, outputPath).Error(0)
+}
+
+func (m *MockContext) exportLibraries(outputPath string) error {
+	return m.Called(outputPath).Error(0)
+}
+
+func (m *MockContext) exportTheme(name string, outputPath string) error {
+	return m.Called(name, outputPath).Error(0)
+}
+
+func (m *MockContext) removeOrphans(cfg config.Config, sections []indexer.Section, outputPath string) error {
+	return m.Called(cfg, sections, outputPath).Error(0)
+}
+
 // MockFunc
 type MockFunc struct {
 	mock.Mock
@@ -144,7 +210,7 @@ func TestExport(t *testing.T) {
 
 	mockCtx := new(MockContext)
 	mockCtx.On("cleanDirectory", mock.Anything).Return(nil)
-	mockCtx.On("buildIndex", mock.Anything).Return(sections, nil)
+	mockCtx.On("buildIndex", mock.Anything, mock.Anything).Return(sections, nil)
 	mockCtx.On("exportPhotos", mock.Anything, mock.Anything, mock.Anything, mock.Anything).Return()
 	mockCtx.On("generateIndexHtml", mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything).Return()
 	mockCtx.On("processOtherFolders", mock.Anything, mock.Anything, mock.Anything, mock.Anything).Return()
@@ -153,14 +219,131 @@ func TestExport(t *testing.T) {
 
 	cfg := new(MockConfig)
 	cfg.On("GetOtherFolders").Return([]string{"folder-1", "folder-2"})
+	cfg.On("GetPageOption").Return(config.PageOption{Template: constants.TemplateFilePath})
+	cfg.On("GetExtractOption").Return(config.ExtractOption{})
+	cfg.On("GetLibraryOption").Return(config.LibraryOption{})
 	outputPath := "test-directory"
-	export(cfg, outputPath, minimizer, cache, mockCtx)
+	export(cfg, outputPath, minimizer, cache, false, mockCtx)
+
+	indexPage := pages.Page{
+		TemplatePath: constants.TemplateFilePath,
+		FilePath:     "index.html",
+		URLPath:      "/",
+	}
 
 	mockCtx.AssertCalled(t, "cleanDirectory", outputPath)
-	mockCtx.AssertCalled(t, "buildIndex", cfg)
+	mockCtx.AssertCalled(t, "buildIndex", cfg, cache)
 	mockCtx.AssertCalled(t, "exportPhotos", sections, filepath.Join(outputPath, "photos"), cache, nil)
-	mockCtx.AssertCalled(t, "generateIndexHtml", cfg, constants.TemplateFilePath, sections, filepath.Join(outputPath, "index.html"), minimizer)
+	mockCtx.AssertCalled(t, "generateIndexHtml", cfg, indexPage, sections, filepath.Join(outputPath, "index.html"), minimizer)
 	mockCtx.AssertCalled(t, "processOtherFolders", []string{"folder-1", "folder-2"}, outputPath, minimizer, nil)
+	mockCtx.AssertNotCalled(t, "removeOrphans", mock.Anything, mock.Anything, mock.Anything)
+	mockCtx.AssertNotCalled(t, "writeManifest", mock.Anything, mock.Anything)
+	mockCtx.AssertNotCalled(t, "exportLibraries", mock.Anything)
+}
+
+func TestIncrementalExport(t *testing.T) {
+	tmp, cache := prepareTempDirAndCache(t)
+	defer os.RemoveAll(tmp)
+
+	var section1 indexer.Section
+	_ = mapstructure.Decode(testdata.Collection1, &section1)
+	sections := []indexer.Section{section1}
+
+	mockCtx := new(MockContext)
+	mockCtx.On("buildIndex", mock.Anything, mock.Anything).Return(sections, nil)
+	mockCtx.On("exportPhotos", mock.Anything, mock.Anything, mock.Anything, mock.Anything).Return()
+	mockCtx.On("generateIndexHtml", mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything).Return()
+	mockCtx.On("processOtherFolders", mock.Anything, mock.Anything, mock.Anything, mock.Anything).Return()
+	mockCtx.On("removeOrphans", mock.Anything, mock.Anything, mock.Anything).Return(nil)
+
+	minimizer := mm.NoneMinimizer{}
+
+	cfg := new(MockConfig)
+	cfg.On("GetOtherFolders").Return([]string{"folder-1"})
+	cfg.On("GetPageOption").Return(config.PageOption{})
+	cfg.On("GetExtractOption").Return(config.ExtractOption{})
+	cfg.On("GetLibraryOption").Return(config.LibraryOption{})
+	outputPath := "test-directory"
+	export(cfg, outputPath, minimizer, cache, true, mockCtx)
+
+	mockCtx.AssertNotCalled(t, "cleanDirectory", mock.Anything)
+	mockCtx.AssertCalled(t, "exportPhotos", sections, filepath.Join(outputPath, "photos"), cache, nil)
+	mockCtx.AssertCalled(t, "removeOrphans", cfg, sections, outputPath)
+}
+
+func TestExportManifest(t *testing.T) {
+	tmp, cache := prepareTempDirAndCache(t)
+	defer os.RemoveAll(tmp)
+
+	sections := []indexer.Section{}
+
+	mockCtx := new(MockContext)
+	mockCtx.On("cleanDirectory", mock.Anything).Return(nil)
+	mockCtx.On("buildIndex", mock.Anything, mock.Anything).Return(sections, nil)
+	mockCtx.On("exportPhotos", mock.Anything, mock.Anything, mock.Anything, mock.Anything).Return()
+	mockCtx.On("generateIndexHtml", mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything).Return()
+	mockCtx.On("processOtherFolders", mock.Anything, mock.Anything, mock.Anything, mock.Anything).Return()
+	mockCtx.On("writeManifest", mock.Anything, mock.Anything).Return(nil)
+
+	cfg := new(MockConfig)
+	cfg.On("GetOtherFolders").Return([]string{})
+	cfg.On("GetPageOption").Return(config.PageOption{})
+	cfg.On("GetExtractOption").Return(config.ExtractOption{HashFileNames: true})
+	cfg.On("GetLibraryOption").Return(config.LibraryOption{})
+	outputPath := "test-directory"
+	export(cfg, outputPath, mm.NoneMinimizer{}, cache, false, mockCtx)
+
+	mockCtx.AssertCalled(t, "writeManifest", sections, outputPath)
+}
+
+func TestExportLocalLibraries(t *testing.T) {
+	tmp, cache := prepareTempDirAndCache(t)
+	defer os.RemoveAll(tmp)
+
+	sections := []indexer.Section{}
+
+	mockCtx := new(MockContext)
+	mockCtx.On("cleanDirectory", mock.Anything).Return(nil)
+	mockCtx.On("buildIndex", mock.Anything, mock.Anything).Return(sections, nil)
+	mockCtx.On("exportPhotos", mock.Anything, mock.Anything, mock.Anything, mock.Anything).Return()
+	mockCtx.On("generateIndexHtml", mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything).Return()
+	mockCtx.On("processOtherFolders", mock.Anything, mock.Anything, mock.Anything, mock.Anything).Return()
+	mockCtx.On("exportLibraries", mock.Anything).Return(nil)
+
+	cfg := new(MockConfig)
+	cfg.On("GetOtherFolders").Return([]string{})
+	cfg.On("GetPageOption").Return(config.PageOption{})
+	cfg.On("GetExtractOption").Return(config.ExtractOption{})
+	cfg.On("GetLibraryOption").Return(config.LibraryOption{Local: true})
+	outputPath := "test-directory"
+	export(cfg, outputPath, mm.NoneMinimizer{}, cache, false, mockCtx)
+
+	mockCtx.AssertCalled(t, "exportLibraries", outputPath)
+}
+
+func TestExportTheme(t *testing.T) {
+	tmp, cache := prepareTempDirAndCache(t)
+	defer os.RemoveAll(tmp)
+
+	sections := []indexer.Section{}
+
+	mockCtx := new(MockContext)
+	mockCtx.On("cleanDirectory", mock.Anything).Return(nil)
+	mockCtx.On("buildIndex", mock.Anything, mock.Anything).Return(sections, nil)
+	mockCtx.On("exportPhotos", mock.Anything, mock.Anything, mock.Anything, mock.Anything).Return()
+	mockCtx.On("generateIndexHtml", mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything).Return()
+	mockCtx.On("processOtherFolders", mock.Anything, mock.Anything, mock.Anything, mock.Anything).Return()
+	mockCtx.On("exportTheme", mock.Anything, mock.Anything).Return(nil)
+
+	cfg := new(MockConfig)
+	cfg.On("GetOtherFolders").Return([]string{})
+	cfg.On("GetPageOption").Return(config.PageOption{Theme: "default", Template: "template.html"})
+	cfg.On("GetExtractOption").Return(config.ExtractOption{})
+	cfg.On("GetLibraryOption").Return(config.LibraryOption{})
+	outputPath := "test-directory"
+	export(cfg, outputPath, mm.NoneMinimizer{}, cache, false, mockCtx)
+
+	mockCtx.AssertCalled(t, "exportTheme", "default", outputPath)
 }
 
 func TestCleanDirectory(t *testing.T) {
@@ -204,6 +387,54 @@ func TestExportPhotos(t *testing.T) {
 	mockFunc.AssertNumberOfCalls(t, "progressFunc", 6) // 6 files
 }
 
+func TestExportPhotosRenditions(t *testing.T) {
+	tmp, cache := prepareTempDirAndCache(t)
+	defer os.RemoveAll(tmp)
+
+	var section indexer.Section
+	_ = mapstructure.Decode(testdata.Collection1, &section)
+	section.ImageSets = section.ImageSets[:1]
+	section.ImageSets[0].ThumbnailSize = images.ImageSize{Width: testdata.ThumbnailWidth}
+	section.ImageSets[0].OriginalSize = images.ImageSize{Width: testdata.ThumbnailWidth}
+	section.ImageSets[0].Variants = []indexer.ImageVariant{
+		{Format: images.FormatPNG, FileName: images.FormatPNG.FileName(testdata.Collection1FileName1)},
+		{Format: images.FormatJPEG, FileName: images.FormatJPEG.FileName(testdata.Collection1FileName1)},
+	}
+
+	section.ImageSets[0].Thumbnails = []indexer.ImageRendition{
+		{Key: "thumbnail-320", Size: images.ImageSize{Width: 320}},
+	}
+
+	ctx := defaultExportContext{}
+	ctx.exportPhotos([]indexer.Section{section}, tmp, cache, nil)
+
+	for _, name := range []string{testdata.Collection1FileName1 + ".png", testdata.Collection1FileName1} {
+		for _, key := range []string{"thumbnail", "original", "thumbnail-320"} {
+			path := filepath.Join(tmp, section.Slug, key, name)
+			assert.Truef(t, files.IsExisting(path), path)
+		}
+	}
+}
+
+func TestExportPhotosKeepsCacheOfOtherSections(t *testing.T) {
+	tmp, cache := prepareTempDirAndCache(t)
+	defer os.RemoveAll(tmp)
+
+	var section indexer.Section
+	_ = mapstructure.Decode(testdata.Collection1, &section)
+	section.ImageSets = section.ImageSets[:1]
+
+	ctx := defaultExportContext{}
+	ctx.exportPhotos([]indexer.Section{section}, tmp, cache, nil)
+	before, _ := cache.Stats()
+	assert.NotZero(t, before.Entries)
+
+	// e.g. an environment without the section
+	ctx.exportPhotos([]indexer.Section{}, tmp, cache, nil)
+	after, _ := cache.Stats()
+	assert.Equal(t, before.Entries, after.Entries)
+}
+
 func TestGenerateIndexHTML(t *testing.T) {
 	tmp, _ := prepareTempDirAndCache(t)
 	defer os.RemoveAll(tmp)
@@ -213,12 +444,15 @@ func TestGenerateIndexHTML(t *testing.T) {
 
 	cfg := MockConfig{}
 	cfg.On("AllSettings").Return(map[string]any{})
+	cfg.On("GetLibraryOption").Return(config.LibraryOption{})
+	cfg.On("GetPageOption").Return(config.PageOption{})
 
 	mockMinimizer := new(MockMinimizer)
 	mockMinimizer.On("MinimizeFile", mock.Anything, mock.Anything).Return(nil)
 
 	ctx := defaultExportContext{}
-	ctx.generateIndexHtml(&cfg, testdata.TestHtmlFile, sections, path, mockMinimizer)
+	page := pages.Page{TemplatePath: testdata.TestHtmlFile, FilePath: "index.html", URLPath: "/"}
+	ctx.generateIndexHtml(&cfg, page, sections, path, mockMinimizer)
 	assert.True(t, files.IsExisting(path))
 	cfg.AssertCalled(t, "AllSettings")
 
@@ -259,6 +493,82 @@ func TestProcessOtherFolders(t *testing.T) {
 	mockMinimizer.AssertCalled(t, "MinimizeFile", mock.Anything, mock.Anything)
 }
 
+func TestRemoveOrphans(t *testing.T) {
+	tmp, cache := prepareTempDirAndCache(t)
+	defer os.RemoveAll(tmp)
+
+	var section indexer.Section
+	_ = mapstructure.Decode(testdata.Collection1, &section)
+	sections := []indexer.Section{section}
+
+	outputPath := filepath.Join(tmp, "output")
+	ctx := defaultExportContext{}
+	ctx.exportPhotos(sections, files.OutputPhotosFilePath(outputPath), cache, nil)
+
+	orphan := filepath.Join(outputPath, "photos", "removed-slug", "original", "removed.jpg")
+	_ = files.WriteDataToFile([]byte("orphan"), orphan)
+
+	cfg := new(MockConfig)
+	cfg.On("GetOtherFolders").Return([]string{})
+	cfg.On("GetPageOption").Return(config.PageOption{})
+	cfg.On("GetExtractOption").Return(config.ExtractOption{})
+	cfg.On("GetLibraryOption").Return(config.LibraryOption{})
+	err := ctx.removeOrphans(cfg, sections, outputPath)
+	assert.Nil(t, err)
+
+	assert.False(t, files.IsExisting(orphan))
+	assert.False(t, files.IsExisting(filepath.Join(outputPath, "photos", "removed-slug")))
+	for _, set := range section.ImageSets {
+		expectedOriginalPath := filepath.Join(outputPath, "photos", section.Slug, "original", set.FileName)
+		assert.Truef(t, files.IsExisting(expectedOriginalPath), expectedOriginalPath)
+	}
+}
+
+func TestIncrementalExportPhotos(t *testing.T) {
+	tmp, cache := prepareTempDirAndCache(t)
+	defer os.RemoveAll(tmp)
+
+	var section indexer.Section
+	_ = mapstructure.Decode(testdata.Collection1, &section)
+	sections := []indexer.Section{section}
+
+	ctx := defaultExportContext{}
+	ctx.exportPhotos(sections, tmp, cache, nil)
+
+	path := filepath.Join(tmp, section.Slug, "original", testdata.Collection1FileName1)
+	past := time.Now().Add(-time.Hour).Truncate(time.Second)
+	_ = os.Chtimes(path, past, past)
+
+	// second export hits the cache and leaves the file untouched
+	ctx.exportPhotos(sections, tmp, cache, nil)
+
+	info, err := os.Stat(path)
+	assert.Nil(t, err)
+	assert.Equal(t, past, info.ModTime())
+}
+
+func TestSyncFolder(t *testing.T) {
+	tmp, _ := os.MkdirTemp("", "foto-test")
+	defer os.RemoveAll(tmp)
+
+	src := filepath.Join(tmp, "src")
+	dst := filepath.Join(tmp, "dst")
+	_ = files.WriteDataToFile([]byte("unchanged"), filepath.Join(src, "a.txt"))
+	_ = files.WriteDataToFile([]byte("new"), filepath.Join(src, "sub", "b.txt"))
+	_ = files.WriteDataToFile([]byte("unchanged"), filepath.Join(dst, "a.txt"))
+
+	past := time.Now().Add(-time.Hour).Truncate(time.Second)
+	_ = os.Chtimes(filepath.Join(dst, "a.txt"), past, past)
+
+	err := syncFolder(src, dst, mm.NoneMinimizer{})
+	assert.Nil(t, err)
+
+	info, _ := os.Stat(filepath.Join(dst, "a.txt"))
+	assert.Equal(t, past, info.ModTime())
+	data, _ := os.ReadFile(filepath.Join(dst, "sub", "b.txt"))
+	assert.Equal(t, "new", string(data))
+}
+
 func TestResizeImageCache(t *testing.T) {
 	tmp, _ := os.MkdirTemp("", "foto-test")
 	defer os.RemoveAll(tmp)
@@ -268,29 +578,55 @@ func TestResizeImageCache(t *testing.T) {
 	width := testdata.ThumbnailWidth
 	height := 0
 	compressQuality := testdata.CompressQuality
+	format := images.FormatJPEG
 	cachedFile := testdata.ThumbnailFile
 
 	// non cached
 	cache1 := new(MockCache)
 
-	cache1.On("CachedImage", src, width, height, compressQuality).Return(nil)
-	cache1.On("AddImage", src, width, height, compressQuality, dst).Return(nil)
+	cache1.On("CachedImage", src, width, height, compressQuality, format).Return(nil)
+	cache1.On("AddImage", src, width, height, compressQuality, format, temporaryFilePath(dst)).Return(nil)
 
-	err := resizeImageAndCache(src, dst, width, height, compressQuality, cache1)
+	err := resizeImageAndCache(images.OpenSource(src), dst, width, height, compressQuality, format, cache1)
 	assert.Nil(t, err)
-	cache1.AssertCalled(t, "CachedImage", src, width, height, compressQuality)
-	cache1.AssertCalled(t, "AddImage", src, width, height, compressQuality, dst)
+	cache1.AssertCalled(t, "CachedImage", src, width, height, compressQuality, format)
+	cache1.AssertCalled(t, "AddImage", src, width, height, compressQuality, format, temporaryFilePath(dst))
+	assert.True(t, files.IsExisting(dst))
+	assert.False(t, files.IsExisting(temporaryFilePath(dst)))
 
 	// cached
 	cache2 := new(MockCache)
 
-	cache2.On("CachedImage", src, width, height, compressQuality).Return(&cachedFile)
-	cache2.On("AddImage", src, width, height, compressQuality, dst).Unset()
+	cache2.On("CachedImage", src, width, height, compressQuality, format).Return(&cachedFile)
+	cache2.On("AddImage", src, width, height, compressQuality, format, dst).Unset()
+
+	err = resizeImageAndCache(images.OpenSource(src), dst, width, height, compressQuality, format, cache2)
+	assert.Nil(t, err)
+	cache2.AssertCalled(t, "CachedImage", src, width, height, compressQuality, format)
+	cache2.AssertNotCalled(t, "AddImage", src, width, height, compressQuality, format, dst)
+}
+
+func TestResizeImageColdCacheKeepsUnchangedOutput(t *testing.T) {
+	tmp, _ := os.MkdirTemp("", "foto-test")
+	defer os.RemoveAll(tmp)
+
+	src := testdata.Testfile
+	dst := filepath.Join(tmp, "resized.jpg")
+	width := testdata.ThumbnailWidth
+	compressQuality := testdata.CompressQuality
+
+	err := resizeImageAndCache(images.OpenSource(src), dst, width, 0, compressQuality, images.FormatJPEG, cache.NewFolderCache(filepath.Join(tmp, "cache1")))
+	assert.Nil(t, err)
 
-	err = resizeImageAndCache(src, dst, width, height, compressQuality, cache2)
+	past := time.Now().Add(-time.Hour).Truncate(time.Second)
+	_ = os.Chtimes(dst, past, past)
+
+	err = resizeImageAndCache(images.OpenSource(src), dst, width, 0, compressQuality, images.FormatJPEG, cache.NewFolderCache(filepath.Join(tmp, "cache2")))
 	assert.Nil(t, err)
-	cache2.AssertCalled(t, "CachedImage", src, width, height, compressQuality)
-	cache2.AssertNotCalled(t, "AddImage", src, width, height, compressQuality, dst)
+
+	info, _ := os.Stat(dst)
+	assert.Equal(t, past, info.ModTime())
+	assert.False(t, files.IsExisting(temporaryFilePath(dst)))
 }
 
 func TestMinimizer(t *testing.T) {
@@ -309,3 +645,65 @@ func prepareTempDirAndCache(t *testing.T) (string, cache.Cache) {
 
 	return tmp, cache
 }
+
+func TestExportLibraries(t *testing.T) {
+	tmp, _ := os.MkdirTemp("", "foto-test")
+	defer os.RemoveAll(tmp)
+
+	site := filepath.Join(tmp, "site")
+	_ = files.WriteDataToFile([]byte("lozad"), filepath.Join(site, "vendor", "lozad", "1.0.0", "lozad.min.js"))
+	t.Chdir(site)
+
+	outputPath := filepath.Join(tmp, "output")
+	err := defaultExportContext{}.exportLibraries(outputPath)
+	assert.Nil(t, err)
+
+	data, err := os.ReadFile(filepath.Join(outputPath, "vendor", "lozad", "1.0.0", "lozad.min.js"))
+	assert.Nil(t, err)
+	assert.Equal(t, "lozad", string(data))
+}
+
+func TestExportEmbeddedLibraries(t *testing.T) {
+	// A site without its own vendor folder
+	t.Chdir(t.TempDir())
+	outputPath := filepath.Join(t.TempDir(), "output")
+
+	err := defaultExportContext{}.exportLibraries(outputPath)
+	if missing := libraries.Missing(); len(missing) > 0 {
+		assert.ErrorContains(t, err, missing[0])
+		assert.NoDirExists(t, filepath.Join(outputPath, libraries.DirectoryName))
+		return
+	}
+
+	assert.Nil(t, err)
+	for _, lib := range libraries.All {
+		expected, _ := fs.ReadFile(libraries.Files(), lib.Path)
+		data, err := os.ReadFile(filepath.Join(outputPath, libraries.DirectoryName, filepath.FromSlash(lib.Path)))
+		assert.Nil(t, err)
+		assert.Equal(t, expected, data)
+	}
+}
+
+func TestExportThemeStatic(t *testing.T) {
+	tmp, _ := os.MkdirTemp("", "foto-test")
+	defer os.RemoveAll(tmp)
+
+	site := filepath.Join(tmp, "site")
+	_ = files.WriteDataToFile([]byte("body {}"), filepath.Join(site, "my-theme", "static", "theme", "style.css"))
+	t.Chdir(site)
+
+	outputPath := filepath.Join(tmp, "output")
+	err := defaultExportContext{}.exportTheme("my-theme", outputPath)
+	assert.Nil(t, err)
+
+	data, err := os.ReadFile(filepath.Join(outputPath, "theme", "style.css"))
+	assert.Nil(t, err)
+	assert.Equal(t, "body {}", string(data))
+
+	err = defaultExportContext{}.exportTheme("default", outputPath)
+	assert.Nil(t, err)
+	assert.True(t, files.IsExisting(filepath.Join(outputPath, "theme", "style.css")))
+
+	err = defaultExportContext{}.exportTheme("missing", outputPath)
+	assert.NotNil(t, err)
+}
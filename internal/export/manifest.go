@@ -0,0 +1,47 @@
+package export
+
+import (
+	"encoding/json"
+	"path"
+	"path/filepath"
+	"slices"
+
+	"github.com/waynezhang/foto/internal/files"
+	"github.com/waynezhang/foto/internal/indexer"
+)
+
+// Written to the output root when file names are content-hashed
+const manifestFileName = "manifest.json"
+
+// Output URLs of every source photo, keyed by the section slug and the path in the section folder,
+// e.g. `travel/tokyo/a.jpg`, so the manifest can be published without local paths
+func buildManifest(sections []indexer.Section) map[string][]string {
+	manifest := map[string][]string{}
+	for _, s := range indexer.Flatten(sections) {
+		for _, set := range s.ImageSets {
+			urls := []string{}
+			for _, variant := range set.OutputVariants() {
+				for _, url := range variant.URLs {
+					urls = append(urls, url)
+				}
+			}
+			slices.Sort(urls)
+			manifest[path.Join(s.Slug, filepath.ToSlash(set.SourcePath("")))] = urls
+		}
+	}
+	return manifest
+}
+
+func writeManifest(sections []indexer.Section, outputPath string) error {
+	data, err := json.MarshalIndent(buildManifest(sections), "", "  ")
+	if err != nil {
+		return err
+	}
+
+	path := filepath.Join(outputPath, manifestFileName)
+	tmpPath := temporaryFilePath(path)
+	if err := files.WriteDataToFile(data, tmpPath); err != nil {
+		return err
+	}
+	return files.MoveFileIfChanged(tmpPath, path)
+}
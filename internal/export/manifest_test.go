@@ -0,0 +1,59 @@
+package export
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/waynezhang/foto/internal/images"
+	"github.com/waynezhang/foto/internal/indexer"
+)
+
+func TestWriteManifest(t *testing.T) {
+	tmp, _ := os.MkdirTemp("", "foto-test")
+	defer os.RemoveAll(tmp)
+
+	sections := []indexer.Section{{
+		Slug:   "slug",
+		Folder: filepath.Join(tmp, "photos"),
+		ImageSets: []indexer.ImageSet{{
+			FileName: "a.jpg",
+			Variants: []indexer.ImageVariant{{
+				Format:   images.FormatJPEG,
+				FileName: "a-123.jpg",
+				URLs: map[string]string{
+					"thumbnail": "photos/slug/thumbnail/a-123.jpg",
+					"original":  "photos/slug/original/a-123.jpg",
+				},
+			}},
+		}, {
+			FileName: "b.jpg",
+			Path:     filepath.Join("sub", "b.jpg"),
+			Variants: []indexer.ImageVariant{{
+				Format:   images.FormatJPEG,
+				FileName: "b-456.jpg",
+				URLs:     map[string]string{"original": "photos/slug/original/b-456.jpg"},
+			}},
+		}},
+	}}
+
+	err := writeManifest(sections, tmp)
+	assert.Nil(t, err)
+
+	data, err := os.ReadFile(filepath.Join(tmp, manifestFileName))
+	assert.Nil(t, err)
+
+	manifest := map[string][]string{}
+	_ = json.Unmarshal(data, &manifest)
+	assert.Equal(t, map[string][]string{
+		"slug/a.jpg": {
+			"photos/slug/original/a-123.jpg",
+			"photos/slug/thumbnail/a-123.jpg",
+		},
+		"slug/sub/b.jpg": {"photos/slug/original/b-456.jpg"},
+	}, manifest)
+	// Keys don't leak the absolute folder
+	assert.NotContains(t, string(data), tmp)
+}
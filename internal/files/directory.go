@@ -14,11 +14,16 @@ func OutputPhotosFilePath(basePath string) string {
 }
 
 func OutputPhotoOriginalFilePath(basePath string, slug string, photoFilePath string) string {
-	return filepath.Join(basePath, slug, "original", filepath.Base(photoFilePath))
+	return OutputPhotoRenditionFilePath(basePath, slug, "original", photoFilePath)
 }
 
 func OutputPhotoThumbnailFilePath(basePath string, slug string, photoFilePath string) string {
-	return filepath.Join(basePath, slug, "thumbnail", filepath.Base(photoFilePath))
+	return OutputPhotoRenditionFilePath(basePath, slug, "thumbnail", photoFilePath)
+}
+
+// `key` is the folder of the rendition, e.g. `original`, `thumbnail` or `thumbnail-320`
+func OutputPhotoRenditionFilePath(basePath string, slug string, key string, photoFilePath string) string {
+	return filepath.Join(basePath, slug, key, filepath.Base(photoFilePath))
 }
 
 func PruneDirectory(path string) error {
@@ -41,3 +46,40 @@ func IsExisting(path string) bool {
 	_, err := os.Stat(path)
 	return !os.IsNotExist(err)
 }
+
+// Remove every file under `root` that is not in `keep`, then remove directories left empty
+func PruneDirectoryExcept(root string, keep map[string]bool) error {
+	if !IsExisting(root) {
+		return nil
+	}
+
+	dirs := []string{}
+	err := filepath.WalkDir(root, func(path string, d os.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			if path != root {
+				dirs = append(dirs, path)
+			}
+			return nil
+		}
+		if keep[filepath.Clean(path)] {
+			return nil
+		}
+		return os.Remove(path)
+	})
+	if err != nil {
+		return err
+	}
+
+	// Deepest directories come last in walk order
+	for i := len(dirs) - 1; i >= 0; i-- {
+		entries, err := os.ReadDir(dirs[i])
+		if err == nil && len(entries) == 0 {
+			_ = os.Remove(dirs[i])
+		}
+	}
+
+	return nil
+}
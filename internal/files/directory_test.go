@@ -42,4 +42,26 @@ func TestPath(t *testing.T) {
 	assert.Equal(t, "base_path/a-slug/original/photo.jpg", filepath.ToSlash(originalPath))
 	thumbnailPath := OutputPhotoThumbnailFilePath("base_path", "a-slug", photoFilePath)
 	assert.Equal(t, "base_path/a-slug/thumbnail/photo.jpg", filepath.ToSlash(thumbnailPath))
+	renditionPath := OutputPhotoRenditionFilePath("base_path", "a-slug", "thumbnail-320", photoFilePath)
+	assert.Equal(t, "base_path/a-slug/thumbnail-320/photo.jpg", filepath.ToSlash(renditionPath))
+}
+
+func TestPruneDirectoryExcept(t *testing.T) {
+	tmp, err := os.MkdirTemp("", "foto-test")
+	assert.Nil(t, err)
+	defer os.RemoveAll(tmp)
+
+	kept := filepath.Join(tmp, "kept", "file")
+	removed := filepath.Join(tmp, "removed", "file")
+	_ = WriteDataToFile([]byte("kept"), kept)
+	_ = WriteDataToFile([]byte("removed"), removed)
+
+	err = PruneDirectoryExcept(tmp, map[string]bool{kept: true})
+	assert.Nil(t, err)
+	assert.True(t, IsExisting(kept))
+	assert.False(t, IsExisting(removed))
+	assert.False(t, IsExisting(filepath.Dir(removed)))
+
+	// no failure on non-existing directory
+	assert.Nil(t, PruneDirectoryExcept(filepath.Join(tmp, "nonexisting"), nil))
 }
@@ -31,3 +31,42 @@ func Checksum(path string) (*string, error) {
 	value := hex.EncodeToString(hasher.Sum(nil))
 	return &value, nil
 }
+
+// Whether both files exist and have identical content
+func IsSameContent(a string, b string) bool {
+	infoA, err := os.Stat(a)
+	if err != nil {
+		return false
+	}
+	infoB, err := os.Stat(b)
+	if err != nil {
+		return false
+	}
+	if infoA.Size() != infoB.Size() {
+		return false
+	}
+
+	checksumA, err := Checksum(a)
+	if err != nil || checksumA == nil {
+		return false
+	}
+	checksumB, err := Checksum(b)
+	if err != nil || checksumB == nil {
+		return false
+	}
+
+	return *checksumA == *checksumB
+}
+
+// Move `src` to `to` unless `to` already has the same content, in which case `src` is removed.
+// Untouched files keep their modification time.
+func MoveFileIfChanged(src string, to string) error {
+	if IsSameContent(src, to) {
+		return os.Remove(src)
+	}
+
+	if err := EnsureParentDirectory(to); err != nil {
+		return err
+	}
+	return os.Rename(src, to)
+}
@@ -4,6 +4,7 @@ import (
 	"os"
 	"path/filepath"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/waynezhang/foto/internal/testdata"
@@ -33,3 +34,38 @@ func TestCheckSum(t *testing.T) {
 	assert.Nil(t, s2)
 	assert.NotNil(t, err)
 }
+
+func TestIsSameContent(t *testing.T) {
+	assert.True(t, IsSameContent(testdata.Testfile, testdata.Testfile))
+	assert.False(t, IsSameContent(testdata.Testfile, testdata.ThumbnailFile))
+	assert.False(t, IsSameContent(testdata.Testfile, "nonexisting-file"))
+}
+
+func TestMoveFileIfChanged(t *testing.T) {
+	tmp, err := os.MkdirTemp("", "foto-test")
+	assert.Nil(t, err)
+	defer os.RemoveAll(tmp)
+
+	src := filepath.Join(tmp, "src")
+	dst := filepath.Join(tmp, "dst")
+
+	_ = WriteDataToFile([]byte("content"), src)
+	assert.Nil(t, MoveFileIfChanged(src, dst))
+	assert.False(t, IsExisting(src))
+	assert.True(t, IsExisting(dst))
+
+	past := time.Now().Add(-time.Hour).Truncate(time.Second)
+	_ = os.Chtimes(dst, past, past)
+
+	// same content keeps the destination untouched
+	_ = WriteDataToFile([]byte("content"), src)
+	assert.Nil(t, MoveFileIfChanged(src, dst))
+	assert.False(t, IsExisting(src))
+	info, _ := os.Stat(dst)
+	assert.Equal(t, past, info.ModTime())
+
+	_ = WriteDataToFile([]byte("changed"), src)
+	assert.Nil(t, MoveFileIfChanged(src, dst))
+	data, _ := os.ReadFile(dst)
+	assert.Equal(t, "changed", string(data))
+}
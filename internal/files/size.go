@@ -0,0 +1,48 @@
+package files
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+var sizeUnits = []string{"B", "KB", "MB", "GB", "TB"}
+
+// Bytes of sizes such as `500MB`, `5GB` or `1.5 TB`, in powers of 1024
+func ParseSize(size string) (int64, error) {
+	s := strings.ToUpper(strings.TrimSpace(size))
+	s = strings.Replace(s, "IB", "B", 1)
+
+	number := strings.TrimRightFunc(s, func(r rune) bool { return r < '0' || r > '9' })
+	unit := strings.TrimSpace(s[len(number):])
+	if unit == "" {
+		unit = "B"
+	} else if !strings.HasSuffix(unit, "B") {
+		unit += "B"
+	}
+
+	value, err := strconv.ParseFloat(number, 64)
+	if err != nil || value < 0 {
+		return 0, fmt.Errorf("invalid size %s", size)
+	}
+	for i, u := range sizeUnits {
+		if u == unit {
+			return int64(value * float64(int64(1)<<(10*i))), nil
+		}
+	}
+	return 0, fmt.Errorf("invalid unit of size %s, supported units are %s", size, strings.Join(sizeUnits, ", "))
+}
+
+// e.g. `1.5 GB`
+func FormatSize(bytes int64) string {
+	value := float64(bytes)
+	i := 0
+	for value >= 1024 && i < len(sizeUnits)-1 {
+		value /= 1024
+		i++
+	}
+	if i == 0 {
+		return fmt.Sprintf("%d B", bytes)
+	}
+	return fmt.Sprintf("%.1f %s", value, sizeUnits[i])
+}
@@ -0,0 +1,36 @@
+package files
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseSize(t *testing.T) {
+	for size, expected := range map[string]int64{
+		"100":    100,
+		"100B":   100,
+		"2KB":    2048,
+		"5GB":    5 << 30,
+		"5gb":    5 << 30,
+		"5G":     5 << 30,
+		"5GiB":   5 << 30,
+		"1.5 MB": 3 << 19,
+		"1TB":    1 << 40,
+	} {
+		bytes, err := ParseSize(size)
+		assert.Nil(t, err, size)
+		assert.Equal(t, expected, bytes, size)
+	}
+
+	for _, size := range []string{"", "GB", "5PB", "-1GB", "five"} {
+		_, err := ParseSize(size)
+		assert.NotNil(t, err, size)
+	}
+}
+
+func TestFormatSize(t *testing.T) {
+	assert.Equal(t, "512 B", FormatSize(512))
+	assert.Equal(t, "1.5 KB", FormatSize(1536))
+	assert.Equal(t, "5.0 GB", FormatSize(5<<30))
+}
@@ -0,0 +1,153 @@
+package images
+
+import (
+	"fmt"
+	"image"
+	"image/jpeg"
+	"image/png"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// Output encoding of a rendition
+type Format string
+
+const (
+	FormatJPEG Format = "jpeg"
+	FormatPNG  Format = "png"
+	FormatWebP Format = "webp"
+	FormatAVIF Format = "avif"
+)
+
+var DefaultFormats = []Format{FormatJPEG}
+
+func ParseFormat(name string) (Format, error) {
+	switch strings.ToLower(strings.TrimSpace(name)) {
+	case "jpeg", "jpg":
+		return FormatJPEG, nil
+	case "png":
+		return FormatPNG, nil
+	case "webp":
+		return FormatWebP, nil
+	case "avif":
+		return FormatAVIF, nil
+	default:
+		return "", fmt.Errorf("unsupported output format: %s", name)
+	}
+}
+
+func ParseFormats(names []string) ([]Format, error) {
+	if len(names) == 0 {
+		return DefaultFormats, nil
+	}
+
+	formats := []Format{}
+	for _, name := range names {
+		f, err := ParseFormat(name)
+		if err != nil {
+			return nil, err
+		}
+		formats = append(formats, f)
+	}
+	return formats, nil
+}
+
+func (f Format) Extension() string {
+	switch f {
+	case FormatJPEG:
+		return ".jpg"
+	default:
+		return "." + string(f)
+	}
+}
+
+func (f Format) MIMEType() string {
+	return "image/" + string(f)
+}
+
+// Output file name of `src` in this format.
+// JPEG keeps the file name of JPEG sources as before, other sources and formats append their extension.
+func (f Format) FileName(src string) string {
+	name := filepath.Base(src)
+	if f == FormatJPEG && isJPEG(name) {
+		return name
+	}
+	return name + f.Extension()
+}
+
+func isJPEG(name string) bool {
+	ext := strings.ToLower(filepath.Ext(name))
+	return ext == ".jpg" || ext == ".jpeg"
+}
+
+func Encode(w io.Writer, img image.Image, format Format, compressQuality int) error {
+	switch format {
+	case FormatJPEG:
+		return jpeg.Encode(w, img, &jpeg.Options{Quality: compressQuality})
+	case FormatPNG:
+		return png.Encode(w, img)
+	case FormatWebP:
+		return encodeWebP(w, img, compressQuality)
+	case FormatAVIF:
+		return encodeAVIF(w, img, compressQuality)
+	default:
+		return fmt.Errorf("unsupported output format: %s", format)
+	}
+}
+
+// WebP is encoded by `cwebp` from libwebp since there is no pure Go lossy encoder
+func encodeWebP(w io.Writer, img image.Image, compressQuality int) error {
+	return encodeWithCommand(w, img, "cwebp", "libwebp", "webp", func(src, dst string) []string {
+		return []string{"-quiet", "-q", strconv.Itoa(compressQuality), src, "-o", dst}
+	})
+}
+
+// AVIF is encoded by `avifenc` from libavif since there is no pure Go encoder
+func encodeAVIF(w io.Writer, img image.Image, compressQuality int) error {
+	return encodeWithCommand(w, img, "avifenc", "libavif", "avif", func(src, dst string) []string {
+		return []string{"-q", strconv.Itoa(compressQuality), src, dst}
+	})
+}
+
+// Encodes `img` by passing it as PNG to the external `command`, which writes `ext` to `dst`
+func encodeWithCommand(w io.Writer, img image.Image, command string, library string, ext string, args func(src, dst string) []string) error {
+	bin, err := exec.LookPath(command)
+	if err != nil {
+		return fmt.Errorf("%s output requires %s (%s) in PATH (%w)", ext, command, library, err)
+	}
+
+	tmp, err := os.MkdirTemp("", "foto-"+ext)
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(tmp)
+
+	src := filepath.Join(tmp, "src.png")
+	dst := filepath.Join(tmp, "dst."+ext)
+
+	f, err := os.Create(src)
+	if err != nil {
+		return err
+	}
+	err = png.Encode(f, img)
+	f.Close()
+	if err != nil {
+		return err
+	}
+
+	out, err := exec.Command(bin, args(src, dst)...).CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("%s failed: %s (%w)", command, strings.TrimSpace(string(out)), err)
+	}
+
+	data, err := os.ReadFile(dst)
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(data)
+	return err
+}
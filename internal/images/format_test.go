@@ -0,0 +1,114 @@
+package images
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"os"
+	"os/exec"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	_ "golang.org/x/image/webp"
+)
+
+func TestParseFormat(t *testing.T) {
+	f, err := ParseFormat("JPG")
+	assert.Nil(t, err)
+	assert.Equal(t, FormatJPEG, f)
+
+	f, err = ParseFormat("webp")
+	assert.Nil(t, err)
+	assert.Equal(t, FormatWebP, f)
+
+	_, err = ParseFormat("gif")
+	assert.NotNil(t, err)
+
+	formats, err := ParseFormats(nil)
+	assert.Nil(t, err)
+	assert.Equal(t, DefaultFormats, formats)
+
+	formats, err = ParseFormats([]string{"avif", "webp", "jpeg"})
+	assert.Nil(t, err)
+	assert.Equal(t, []Format{FormatAVIF, FormatWebP, FormatJPEG}, formats)
+
+	_, err = ParseFormats([]string{"webp", "gif"})
+	assert.NotNil(t, err)
+}
+
+func TestFormatFileName(t *testing.T) {
+	assert.Equal(t, "photo.jpg", FormatJPEG.FileName("some-directory/photo.jpg"))
+	assert.Equal(t, "photo.JPEG", FormatJPEG.FileName("photo.JPEG"))
+	assert.Equal(t, "photo.png.jpg", FormatJPEG.FileName("photo.png"))
+	assert.Equal(t, "photo.webp.jpg", FormatJPEG.FileName("photo.webp"))
+	assert.Equal(t, "photo.jpg.webp", FormatWebP.FileName("photo.jpg"))
+	assert.Equal(t, "photo.jpg.avif", FormatAVIF.FileName("photo.jpg"))
+	assert.Equal(t, "photo.jpg.png", FormatPNG.FileName("photo.jpg"))
+
+	assert.Equal(t, "image/webp", FormatWebP.MIMEType())
+	assert.Equal(t, "image/jpeg", FormatJPEG.MIMEType())
+}
+
+func TestEncodeKeepsTransparency(t *testing.T) {
+	img := image.NewNRGBA(image.Rect(0, 0, 4, 4))
+	img.Set(1, 1, color.NRGBA{R: 255, A: 128})
+
+	formats := []Format{FormatPNG}
+	if hasEncoder(t, "cwebp") {
+		formats = append(formats, FormatWebP)
+	}
+	for _, format := range formats {
+		buf := new(bytes.Buffer)
+		err := Encode(buf, img, format, 75)
+		assert.Nil(t, err)
+
+		decoded, name, err := image.Decode(buf)
+		assert.Nil(t, err)
+		assert.Equal(t, string(format), name)
+
+		_, _, _, a := decoded.At(0, 0).RGBA()
+		assert.Equal(t, uint32(0), a)
+	}
+}
+
+func TestEncodeWebPQuality(t *testing.T) {
+	if !hasEncoder(t, "cwebp") {
+		t.Skip("cwebp not found")
+	}
+
+	img := image.NewNRGBA(image.Rect(0, 0, 64, 64))
+	for x := 0; x < 64; x++ {
+		for y := 0; y < 64; y++ {
+			img.Set(x, y, color.NRGBA{R: uint8(x * 4), G: uint8(y * 4), B: uint8(x * y), A: 255})
+		}
+	}
+
+	low := new(bytes.Buffer)
+	assert.Nil(t, Encode(low, img, FormatWebP, 10))
+	high := new(bytes.Buffer)
+	assert.Nil(t, Encode(high, img, FormatWebP, 95))
+	assert.Less(t, low.Len(), high.Len())
+}
+
+func TestEncodeAVIF(t *testing.T) {
+	if !hasEncoder(t, "avifenc") {
+		t.Skip("avifenc not found")
+	}
+
+	img := image.NewNRGBA(image.Rect(0, 0, 4, 4))
+	buf := new(bytes.Buffer)
+	err := Encode(buf, img, FormatAVIF, 75)
+	assert.Nil(t, err)
+	assert.True(t, buf.Len() > 0)
+}
+
+// Whether the external encoder `command` is installed. Fails in CI, which installs them.
+func hasEncoder(t *testing.T, command string) bool {
+	if _, err := exec.LookPath(command); err != nil {
+		if os.Getenv("CI") != "" {
+			t.Fatalf("%s not found", command)
+		}
+		return false
+	}
+	return true
+}
@@ -4,13 +4,13 @@ import (
 	"bytes"
 	"fmt"
 	"image"
-	"image/jpeg"
 	_ "image/jpeg"
 	"math"
 	"os"
 	"path/filepath"
 	"slices"
 	"strings"
+	"sync"
 
 	"github.com/bep/imagemeta"
 	"github.com/disintegration/imaging"
@@ -30,16 +30,41 @@ func IsPhotoSupported(path string) bool {
 		strings.ToLower(filepath.Ext(path)))
 }
 
-func GetPhotoSize(path string) (*ImageSize, error) {
-	src, err := openImage(path)
+// Size of the photo as displayed, read from its header without decoding it.
+// The EXIF `orientation` is read along with other metadata by `GetMetadata`.
+func GetOrientedPhotoSize(path string, orientation int) (*ImageSize, error) {
+	f, err := os.Open(path)
 	if err != nil {
 		return nil, err
 	}
+	defer f.Close()
 
-	return &ImageSize{
-		src.Bounds().Size().X,
-		src.Bounds().Size().Y,
-	}, nil
+	cfg, _, err := image.DecodeConfig(f)
+	if err != nil {
+		return nil, err
+	}
+
+	// Orientations 5 to 8 are rotated by 90 or 270 degrees
+	if orientation >= 5 && orientation <= 8 {
+		return &ImageSize{cfg.Height, cfg.Width}, nil
+	}
+	return &ImageSize{cfg.Width, cfg.Height}, nil
+}
+
+// Bytes of the image once decoded, estimated from its header, 0 if unknown
+func DecodedBytes(path string) int64 {
+	f, err := os.Open(path)
+	if err != nil {
+		return 0
+	}
+	defer f.Close()
+
+	cfg, _, err := image.DecodeConfig(f)
+	if err != nil {
+		return 0
+	}
+	// 4 bytes per pixel, as decoded by imaging
+	return int64(cfg.Width) * int64(cfg.Height) * 4
 }
 
 func AspectedSize(size ImageSize, width int, minHeight int) ImageSize {
@@ -53,9 +78,34 @@ func AspectedSize(size ImageSize, width int, minHeight int) ImageSize {
 	return ImageSize{width, height}
 }
 
-func ResizeImage(src string, to string, width int, height int, compressQuality int) error {
-	log.Debug().Msgf("Resizing %s to %dx%d", src, width, height)
-	data, err := ResizeData(src, width, height, compressQuality)
+// A photo decoded on first use, so all renditions of it share one decoded image
+// and renditions found in the cache don't decode it at all
+type Source struct {
+	Path string
+
+	once sync.Once
+	img  image.Image
+	err  error
+}
+
+func OpenSource(path string) *Source {
+	return &Source{Path: path}
+}
+
+func (s *Source) Image() (image.Image, error) {
+	s.once.Do(func() {
+		s.img, s.err = imaging.Open(s.Path, imaging.AutoOrientation(true))
+	})
+	return s.img, s.err
+}
+
+func ResizeData(path string, width int, height int, compressQuality int, format Format) (*bytes.Buffer, error) {
+	return OpenSource(path).ResizeData(width, height, compressQuality, format)
+}
+
+func (s *Source) Resize(to string, width int, height int, compressQuality int, format Format) error {
+	log.Debug().Msgf("Resizing %s to %dx%d %s", s.Path, width, height, format)
+	data, err := s.ResizeData(width, height, compressQuality, format)
 	if err != nil {
 		return err
 	}
@@ -66,8 +116,8 @@ func ResizeImage(src string, to string, width int, height int, compressQuality i
 	return nil
 }
 
-func ResizeData(path string, width int, height int, compressQuality int) (*bytes.Buffer, error) {
-	src, err := openImage(path)
+func (s *Source) ResizeData(width int, height int, compressQuality int, format Format) (*bytes.Buffer, error) {
+	src, err := s.Image()
 	if err != nil {
 		return nil, err
 	}
@@ -76,49 +126,13 @@ func ResizeData(path string, width int, height int, compressQuality int) (*bytes
 	// If both are specified, resize to exact dimensions
 	resized := imaging.Resize(src, width, height, imaging.Lanczos)
 	buf := new(bytes.Buffer)
-	opt := jpeg.Options{Quality: compressQuality}
-	if err := jpeg.Encode(buf, resized, &opt); err != nil {
+	if err := Encode(buf, resized, format, compressQuality); err != nil {
 		return nil, err
 	}
 
 	return buf, nil
 }
 
-func openImage(path string) (image.Image, error) {
-	return imaging.Open(path, imaging.AutoOrientation(true))
-}
-
-func GetEXIFValues(path string) (map[string]string, error) {
-	img, err := os.Open(path)
-
-	if err != nil {
-		return nil, err
-	}
-	defer img.Close()
-
-	tags := map[string]string{}
-	handleTag := func(ti imagemeta.TagInfo) error {
-		tags[ti.Tag] = fmt.Sprintf("%v", ti.Value)
-		return nil
-	}
-
-	imageFormat := extToFormat(filepath.Ext(path))
-
-	_, err = imagemeta.Decode(
-		imagemeta.Options{
-			R:           img,
-			ImageFormat: imageFormat,
-			HandleTag:   handleTag,
-			Sources:     imagemeta.EXIF,
-		},
-	)
-	if err != nil {
-		return nil, err
-	}
-
-	return tags, nil
-}
-
 func extToFormat(ext string) imagemeta.ImageFormat {
 	switch strings.ToLower(ext) {
 	case ".jpg", ".jpeg":
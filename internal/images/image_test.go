@@ -18,21 +18,35 @@ func TestPhotoSupport(t *testing.T) {
 	assert.False(t, IsPhotoSupported("photo.xxx"))
 }
 
-func TestGetPhotoSize(t *testing.T) {
-	size, err := GetPhotoSize(testdata.Testfile)
+// Size as displayed, the same way the indexer reads it
+func photoSize(path string) (*ImageSize, error) {
+	meta, err := GetMetadata(path)
+	if err != nil {
+		return nil, err
+	}
+	return GetOrientedPhotoSize(path, meta.Orientation)
+}
+
+func TestGetOrientedPhotoSize(t *testing.T) {
+	size, err := photoSize(testdata.Testfile)
 	assert.Nil(t, err)
 	assert.Equal(t, testdata.TestfileWidth, size.Width)
 	assert.Equal(t, testdata.TestfileHeight, size.Height)
 
 	// test against image with orientation data
-	size, _ = GetPhotoSize(testdata.RotatedImageFile)
+	size, _ = photoSize(testdata.RotatedImageFile)
 	assert.Equal(t, testdata.RotatedImageWidth, size.Width)
 	assert.Equal(t, testdata.RotatedImageHeight, size.Height)
 
-	_, err = GetPhotoSize("nonexisting-file.jpg")
+	_, err = photoSize("nonexisting-file.jpg")
 	assert.True(t, os.IsNotExist(err))
 }
 
+func TestDecodedBytes(t *testing.T) {
+	assert.Equal(t, int64(testdata.TestfileWidth*testdata.TestfileHeight*4), DecodedBytes(testdata.Testfile))
+	assert.Equal(t, int64(0), DecodedBytes("nonexisting-file.jpg"))
+}
+
 func TestAspectedSize(t *testing.T) {
 	assert.Equal(t, ImageSize{640, 480}, AspectedSize(ImageSize{2048, 1536}, 640, 0))
 	assert.Equal(t, ImageSize{640, 480}, AspectedSize(ImageSize{2048, 1536}, 640, 100))
@@ -45,11 +59,11 @@ func TestResizeImage(t *testing.T) {
 
 	path := filepath.Join(tmp, "resized.jpg")
 
-	err = ResizeImage("nonexisting-file.jpg", path, testdata.ThumbnailWidth, 0, testdata.CompressQuality)
+	err = OpenSource("nonexisting-file.jpg").Resize(path, testdata.ThumbnailWidth, 0, testdata.CompressQuality, FormatJPEG)
 	assert.True(t, os.IsNotExist(err))
 	assert.False(t, files.IsExisting(path))
 
-	err = ResizeImage(testdata.Testfile, path, testdata.ThumbnailWidth, 0, testdata.CompressQuality)
+	err = OpenSource(testdata.Testfile).Resize(path, testdata.ThumbnailWidth, 0, testdata.CompressQuality, FormatJPEG)
 	assert.Nil(t, err)
 
 	checksum, _ := files.Checksum(path)
@@ -62,21 +76,40 @@ func TestResizeWithRotation(t *testing.T) {
 
 	path := filepath.Join(tmp, "resized.jpg")
 
-	err = ResizeImage(testdata.RotatedImageFile, path, testdata.ThumbnailWidth, 0, testdata.CompressQuality)
+	err = OpenSource(testdata.RotatedImageFile).Resize(path, testdata.ThumbnailWidth, 0, testdata.CompressQuality, FormatJPEG)
 	assert.Nil(t, err)
 
-	size, _ := GetPhotoSize(path)
+	size, _ := photoSize(path)
 	assert.Equal(t, testdata.RotatedImageThumbnailWidth, size.Width)
 	assert.Equal(t, testdata.RotatedImageThumbnailHeight, size.Height)
 }
 
+func TestSource(t *testing.T) {
+	src := OpenSource(testdata.RotatedImageFile)
+	img, err := src.Image()
+	assert.Nil(t, err)
+	assert.Equal(t, testdata.RotatedImageWidth, img.Bounds().Dx())
+	assert.Equal(t, testdata.RotatedImageHeight, img.Bounds().Dy())
+
+	// Decoded once for all renditions
+	again, _ := src.Image()
+	assert.Same(t, img, again)
+
+	data, err := src.ResizeData(testdata.ThumbnailWidth, 0, testdata.CompressQuality, FormatJPEG)
+	assert.Nil(t, err)
+	assert.NotZero(t, data.Len())
+
+	_, err = OpenSource("nonexisting-file.jpg").Image()
+	assert.True(t, os.IsNotExist(err))
+}
+
 func TestCompressQuality(t *testing.T) {
 	tmp, err := os.MkdirTemp("", "foto-test")
 	assert.Nil(t, err)
 
 	path := filepath.Join(tmp, "resized.jpg")
 
-	err = ResizeImage(testdata.Testfile, path, testdata.ThumbnailWidth, 0, testdata.CompressQualityHQ)
+	err = OpenSource(testdata.Testfile).Resize(path, testdata.ThumbnailWidth, 0, testdata.CompressQualityHQ, FormatJPEG)
 	assert.Nil(t, err)
 
 	checksum, _ := files.Checksum(path)
@@ -87,16 +120,16 @@ func TestWebpSupport(t *testing.T) {
 	tmp, err := os.MkdirTemp("", "foto-test")
 	assert.Nil(t, err)
 
-	size, err := GetPhotoSize(testdata.WebpTestFile)
+	size, err := photoSize(testdata.WebpTestFile)
 	assert.Equal(t, testdata.WebpTestfileWidth, size.Width)
 	assert.Equal(t, testdata.WebpTestfileHeight, size.Height)
 
-	path := filepath.Join(tmp, "resized.webp")
+	path := filepath.Join(tmp, "resized.jpg")
 
-	err = ResizeImage(testdata.WebpTestFile, path, testdata.WebpThumbnailWidth, 0, testdata.CompressQuality)
+	err = OpenSource(testdata.WebpTestFile).Resize(path, testdata.WebpThumbnailWidth, 0, testdata.CompressQuality, FormatJPEG)
 	assert.Nil(t, err)
 
-	size, err = GetPhotoSize(path)
+	size, err = photoSize(path)
 	assert.Equal(t, testdata.WebpThumbnailWidth, size.Width)
 	assert.Equal(t, testdata.WebpThumbnailHeight, size.Height)
 
@@ -108,16 +141,16 @@ func TestPngSupport(t *testing.T) {
 	tmp, err := os.MkdirTemp("", "foto-test")
 	assert.Nil(t, err)
 
-	size, err := GetPhotoSize(testdata.PngTestFile)
+	size, err := photoSize(testdata.PngTestFile)
 	assert.Equal(t, testdata.PngTestfileWidth, size.Width)
 	assert.Equal(t, testdata.PngTestfileHeight, size.Height)
 
-	path := filepath.Join(tmp, "resized.png")
+	path := filepath.Join(tmp, "resized.jpg")
 
-	err = ResizeImage(testdata.PngTestFile, path, testdata.PngThumbnailWidth, 0, testdata.CompressQuality)
+	err = OpenSource(testdata.PngTestFile).Resize(path, testdata.PngThumbnailWidth, 0, testdata.CompressQuality, FormatJPEG)
 	assert.Nil(t, err)
 
-	size, err = GetPhotoSize(path)
+	size, err = photoSize(path)
 	assert.Equal(t, testdata.PngThumbnailWidth, size.Width)
 	assert.Equal(t, testdata.PngThumbnailHeight, size.Height)
 
@@ -126,8 +159,9 @@ func TestPngSupport(t *testing.T) {
 }
 
 func TestGetImageEXIF(t *testing.T) {
-	exif, err := GetEXIFValues(testdata.MetadataTestFile)
+	meta, err := GetMetadata(testdata.MetadataTestFile)
 	assert.Nil(t, err)
+	exif := meta.EXIF
 
 	assert.Equal(t, testdata.ExpectedImageDescription, exif["ImageDescription"])
 	assert.Equal(t, testdata.ExpectedMake, exif["Make"])
@@ -138,19 +172,22 @@ func TestGetImageEXIF(t *testing.T) {
 }
 
 func TestGetEmptyImageDescription(t *testing.T) {
-	exif, err := GetEXIFValues(testdata.RotatedImageFile)
+	meta, err := GetMetadata(testdata.RotatedImageFile)
 	assert.Nil(t, err)
+	exif := meta.EXIF
 	assert.Equal(t, "", exif["ImageDescription"])
 }
 
 func TestGetPngImageDescription(t *testing.T) {
-	exif, err := GetEXIFValues(testdata.PngMetadataTestFile)
+	meta, err := GetMetadata(testdata.PngMetadataTestFile)
 	assert.Nil(t, err)
+	exif := meta.EXIF
 	assert.Equal(t, testdata.PngExpectedImageDescription, exif["ImageDescription"])
 }
 
 func TestGetEmptyPngImageDescription(t *testing.T) {
-	exif, err := GetEXIFValues(testdata.PngTestFile)
+	meta, err := GetMetadata(testdata.PngTestFile)
 	assert.Nil(t, err)
+	exif := meta.EXIF
 	assert.Equal(t, "", exif["ImageDescription"])
 }
@@ -0,0 +1,201 @@
+package images
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/bep/imagemeta"
+)
+
+// Normalized shooting information of a photo, zero values for unknown fields
+type PhotoInfo struct {
+	Make  string
+	Model string
+	Lens  string
+	// In millimeters
+	FocalLength float64
+	// F-number
+	Aperture float64
+	// In seconds
+	ExposureTime float64
+	ISO          int
+	// Zero if unknown. The offset from EXIF `OffsetTimeOriginal` is kept when present.
+	CaptureTime time.Time
+	HasGPS      bool
+	Latitude    float64
+	Longitude   float64
+}
+
+// Make and model, without repeating the make when the model already starts with it
+func (info PhotoInfo) Camera() string {
+	if info.Model == "" || strings.HasPrefix(strings.ToLower(info.Model), strings.ToLower(info.Make)) {
+		return info.Model
+	}
+	return strings.TrimSpace(info.Make + " " + info.Model)
+}
+
+// e.g. `50mm`
+func (info PhotoInfo) FormattedFocalLength() string {
+	if info.FocalLength <= 0 {
+		return ""
+	}
+	return strconv.FormatFloat(roundTo(info.FocalLength, 1), 'f', -1, 64) + "mm"
+}
+
+// e.g. `f/5.6`
+func (info PhotoInfo) FormattedAperture() string {
+	if info.Aperture <= 0 {
+		return ""
+	}
+	return "f/" + strconv.FormatFloat(roundTo(info.Aperture, 1), 'f', -1, 64)
+}
+
+// e.g. `1/250s`, `0.5s` or `2s`
+func (info PhotoInfo) FormattedExposureTime() string {
+	return FormatExposureTime(info.ExposureTime)
+}
+
+// Exposure time in seconds as shown by cameras, e.g. `1/340s` or `2.5s`
+func FormatExposureTime(t float64) string {
+	if t <= 0 {
+		return ""
+	}
+	if t < 0.5 {
+		return fmt.Sprintf("1/%ds", int(math.Round(1/t)))
+	}
+	return strconv.FormatFloat(roundTo(t, 1), 'f', -1, 64) + "s"
+}
+
+// e.g. `ISO 100`
+func (info PhotoInfo) FormattedISO() string {
+	if info.ISO <= 0 {
+		return ""
+	}
+	return fmt.Sprintf("ISO %d", info.ISO)
+}
+
+// Capture time in Go layout, e.g. `2006-01-02`
+func (info PhotoInfo) FormattedCaptureTime(layout string) string {
+	if info.CaptureTime.IsZero() {
+		return ""
+	}
+	return info.CaptureTime.Format(layout)
+}
+
+func buildPhotoInfo(tags imagemeta.Tags, xmp map[string]string) PhotoInfo {
+	exif := tags.EXIF()
+	info := PhotoInfo{
+		Make:  strings.TrimSpace(tagString(exif, "Make")),
+		Model: strings.TrimSpace(tagString(exif, "Model")),
+		Lens:  strings.TrimSpace(tagString(exif, "LensModel")),
+	}
+	if info.Lens == "" {
+		info.Lens = xmp["Lens"]
+	}
+
+	info.FocalLength, _ = tagFloat(exif, "FocalLength")
+	if v, ok := tagFloat(exif, "FNumber"); ok {
+		info.Aperture = v
+	} else {
+		// ApertureValue is converted from APEX to an f-number by imagemeta
+		info.Aperture, _ = tagFloat(exif, "ApertureValue")
+	}
+	if v, ok := tagFloat(exif, "ExposureTime"); ok {
+		info.ExposureTime = v
+	} else {
+		info.ExposureTime, _ = tagFloat(exif, "ShutterSpeedValue")
+	}
+	if v, ok := tagFloat(exif, "ISO"); ok {
+		info.ISO = int(v)
+	}
+
+	info.CaptureTime = captureTime(tags)
+
+	if lat, long, err := tags.GetLatLong(); err == nil && (lat != 0 || long != 0) {
+		info.HasGPS = true
+		info.Latitude = lat
+		info.Longitude = long
+	}
+
+	return info
+}
+
+func captureTime(tags imagemeta.Tags) time.Time {
+	exif := tags.EXIF()
+	dateTime := tagString(exif, "DateTimeOriginal")
+	offset := tagString(exif, "OffsetTimeOriginal")
+	if dateTime != "" && offset != "" {
+		if t, err := time.Parse("2006:01:02 15:04:05-07:00", dateTime+offset); err == nil {
+			return t
+		}
+	}
+
+	t, err := tags.GetDateTime()
+	if err != nil {
+		return time.Time{}
+	}
+	return t
+}
+
+func tagString(tags map[string]imagemeta.TagInfo, name string) string {
+	ti, ok := tags[name]
+	if !ok {
+		return ""
+	}
+	if s, ok := ti.Value.(string); ok {
+		return s
+	}
+	return fmt.Sprintf("%v", ti.Value)
+}
+
+func tagFloat(tags map[string]imagemeta.TagInfo, name string) (float64, bool) {
+	ti, ok := tags[name]
+	if !ok {
+		return 0, false
+	}
+	return toFloat(ti.Value)
+}
+
+func toFloat(v any) (float64, bool) {
+	switch val := v.(type) {
+	case interface{ Float64() float64 }:
+		f := val.Float64()
+		return f, !math.IsNaN(f) && !math.IsInf(f, 0)
+	case float64:
+		return val, true
+	case float32:
+		return float64(val), true
+	case int:
+		return float64(val), true
+	case int16:
+		return float64(val), true
+	case int32:
+		return float64(val), true
+	case int64:
+		return float64(val), true
+	case uint16:
+		return float64(val), true
+	case uint32:
+		return float64(val), true
+	case uint64:
+		return float64(val), true
+	case uint8:
+		return float64(val), true
+	case []uint16:
+		if len(val) > 0 {
+			return float64(val[0]), true
+		}
+	case string:
+		f, err := strconv.ParseFloat(strings.TrimSpace(val), 64)
+		return f, err == nil
+	}
+	return 0, false
+}
+
+func roundTo(v float64, digits int) float64 {
+	p := math.Pow(10, float64(digits))
+	return math.Round(v*p) / p
+}
@@ -0,0 +1,37 @@
+package images
+
+import (
+	"testing"
+	"time"
+
+	"github.com/bep/imagemeta"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPhotoInfoCamera(t *testing.T) {
+	assert.Equal(t, "FUJIFILM GFX 50R", PhotoInfo{Make: "FUJIFILM", Model: "GFX 50R"}.Camera())
+	assert.Equal(t, "Canon EOS R5", PhotoInfo{Make: "Canon", Model: "Canon EOS R5"}.Camera())
+	assert.Equal(t, "", PhotoInfo{Make: "Canon"}.Camera())
+}
+
+func TestPhotoInfoFormatters(t *testing.T) {
+	info := PhotoInfo{FocalLength: 23.5, Aperture: 5.6, ExposureTime: 2}
+	assert.Equal(t, "23.5mm", info.FormattedFocalLength())
+	assert.Equal(t, "f/5.6", info.FormattedAperture())
+	assert.Equal(t, "2s", info.FormattedExposureTime())
+
+	info.ExposureTime = 0.004
+	assert.Equal(t, "1/250s", info.FormattedExposureTime())
+	info.ExposureTime = 0.5
+	assert.Equal(t, "0.5s", info.FormattedExposureTime())
+}
+
+func TestCaptureTimeWithOffset(t *testing.T) {
+	tags := imagemeta.Tags{}
+	tags.Add(imagemeta.TagInfo{Source: imagemeta.EXIF, Tag: "DateTimeOriginal", Value: "2022:06:26 14:37:12"})
+	tags.Add(imagemeta.TagInfo{Source: imagemeta.EXIF, Tag: "OffsetTimeOriginal", Value: "+09:00"})
+
+	ct := captureTime(tags)
+	assert.Equal(t, time.Date(2022, 6, 26, 5, 37, 12, 0, time.UTC), ct.UTC())
+	assert.Equal(t, "2022-06-26T14:37:12+09:00", ct.Format(time.RFC3339))
+}
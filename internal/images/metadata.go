@@ -0,0 +1,214 @@
+package images
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/bep/imagemeta"
+	"github.com/rs/zerolog/log"
+)
+
+const rdfNamespace = "http://www.w3.org/1999/02/22-rdf-syntax-ns#"
+
+// Embedded metadata of a photo, one map per source keyed by tag name
+type Metadata struct {
+	EXIF map[string]string
+	IPTC map[string]string
+	// Includes values of the `.xmp` sidecar file, which take precedence over embedded values
+	XMP map[string]string
+	// Typed values normalized from the maps above
+	Info PhotoInfo
+	// EXIF orientation, 1 when missing
+	Orientation int
+}
+
+func GetMetadata(path string) (*Metadata, error) {
+	meta := &Metadata{
+		EXIF: map[string]string{},
+		IPTC: map[string]string{},
+		XMP:  map[string]string{},
+	}
+
+	tags := imagemeta.Tags{}
+	handleTag := func(ti imagemeta.TagInfo) error {
+		tags.Add(ti)
+		switch ti.Source {
+		case imagemeta.EXIF:
+			meta.EXIF[ti.Tag] = tagValueString(ti.Value)
+		case imagemeta.IPTC:
+			meta.IPTC[ti.Tag] = tagValueString(ti.Value)
+		}
+		return nil
+	}
+	// The XMP decoder of imagemeta skips common tags like dc:title, so packets are parsed here
+	handleXMP := func(r io.Reader) error {
+		data, err := io.ReadAll(r)
+		if err != nil {
+			return err
+		}
+		tags, err := parseXMP(data)
+		if err != nil {
+			log.Warn().Msgf("Failed to parse XMP of %s (%v)", path, err)
+			return nil
+		}
+		for k, v := range tags {
+			meta.XMP[k] = v
+		}
+		return nil
+	}
+
+	err := decodeMetadata(path, imagemeta.EXIF|imagemeta.IPTC|imagemeta.XMP, handleTag, handleXMP)
+	if err != nil {
+		return nil, err
+	}
+
+	if sidecar := XMPSidecarPath(path); sidecar != "" {
+		data, err := os.ReadFile(sidecar)
+		if err == nil {
+			var tags map[string]string
+			tags, err = parseXMP(data)
+			for k, v := range tags {
+				meta.XMP[k] = v
+			}
+		}
+		if err != nil {
+			log.Warn().Msgf("Failed to parse XMP sidecar %s (%v)", sidecar, err)
+		}
+	}
+
+	meta.Info = buildPhotoInfo(tags, meta.XMP)
+	meta.Orientation = 1
+	if v, ok := tagFloat(tags.EXIF(), "Orientation"); ok {
+		meta.Orientation = int(v)
+	}
+
+	return meta, nil
+}
+
+func decodeMetadata(path string, sources imagemeta.Source, handleTag func(imagemeta.TagInfo) error, handleXMP func(io.Reader) error) error {
+	img, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer img.Close()
+
+	_, err = imagemeta.Decode(
+		imagemeta.Options{
+			R:           img,
+			ImageFormat: extToFormat(filepath.Ext(path)),
+			HandleTag:   handleTag,
+			HandleXMP:   handleXMP,
+			Sources:     sources,
+		},
+	)
+	return err
+}
+
+func tagValueString(value any) string {
+	if values, ok := value.([]string); ok {
+		return strings.Join(values, ", ")
+	}
+	return fmt.Sprintf("%v", value)
+}
+
+// `photo.xmp` (e.g. written for `photo.raw` and shared with `photo.jpg` derived from it)
+// or `photo.jpg.xmp`, if any
+func XMPSidecarPath(path string) string {
+	base := strings.TrimSuffix(path, filepath.Ext(path))
+	for _, candidate := range []string{
+		path + ".xmp",
+		path + ".XMP",
+		base + ".xmp",
+		base + ".XMP",
+	} {
+		if info, err := os.Stat(candidate); err == nil && !info.IsDir() {
+			return candidate
+		}
+	}
+	return ""
+}
+
+type xmpNode struct {
+	XMLName  xml.Name
+	Attrs    []xml.Attr `xml:",any,attr"`
+	Content  string     `xml:",chardata"`
+	Children []xmpNode  `xml:",any"`
+}
+
+// Flatten properties of every rdf:Description into tags keyed by their local name, e.g. `Title`.
+// Language alternatives take the first item, bags and sequences are joined with commas.
+func parseXMP(data []byte) (map[string]string, error) {
+	// Packets can be padded with whitespace and wrapped in <?xpacket?> instructions
+	data = bytes.TrimSpace(data)
+
+	var root xmpNode
+	if err := xml.Unmarshal(data, &root); err != nil {
+		return nil, err
+	}
+
+	tags := map[string]string{}
+	var walk func(node xmpNode)
+	walk = func(node xmpNode) {
+		if node.XMLName.Space == rdfNamespace && node.XMLName.Local == "Description" {
+			for _, attr := range node.Attrs {
+				if attr.Name.Space == rdfNamespace || attr.Name.Space == "xmlns" || attr.Name.Space == "" {
+					continue
+				}
+				tags[firstUpper(attr.Name.Local)] = strings.TrimSpace(attr.Value)
+			}
+			for _, child := range node.Children {
+				if value := xmpValue(child); value != "" {
+					tags[firstUpper(child.XMLName.Local)] = value
+				}
+			}
+			return
+		}
+		for _, child := range node.Children {
+			walk(child)
+		}
+	}
+	walk(root)
+
+	return tags, nil
+}
+
+func xmpValue(node xmpNode) string {
+	for _, child := range node.Children {
+		if child.XMLName.Space != rdfNamespace {
+			continue
+		}
+
+		items := []string{}
+		for _, li := range child.Children {
+			if item := strings.TrimSpace(li.Content); item != "" {
+				items = append(items, item)
+			}
+		}
+		switch child.XMLName.Local {
+		case "Alt":
+			if len(items) > 0 {
+				return items[0]
+			}
+			return ""
+		case "Bag", "Seq":
+			return strings.Join(items, ", ")
+		}
+	}
+
+	return strings.TrimSpace(node.Content)
+}
+
+func firstUpper(s string) string {
+	r, n := utf8.DecodeRuneInString(s)
+	if r == utf8.RuneError {
+		return s
+	}
+	return string(unicode.ToUpper(r)) + s[n:]
+}
@@ -0,0 +1,137 @@
+package images
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	cp "github.com/otiai10/copy"
+	"github.com/stretchr/testify/assert"
+	"github.com/waynezhang/foto/internal/files"
+	"github.com/waynezhang/foto/internal/testdata"
+)
+
+const testXMP = `<?xpacket begin="" id="W5M0MpCehiHzreSzNTczkc9d"?>
+<x:xmpmeta xmlns:x="adobe:ns:meta/">
+  <rdf:RDF xmlns:rdf="http://www.w3.org/1999/02/22-rdf-syntax-ns#">
+    <rdf:Description rdf:about=""
+        xmlns:dc="http://purl.org/dc/elements/1.1/"
+        xmlns:xmp="http://ns.adobe.com/xap/1.0/"
+        xmp:Rating="5">
+      <dc:title>
+        <rdf:Alt>
+          <rdf:li xml:lang="x-default">Sidecar title</rdf:li>
+        </rdf:Alt>
+      </dc:title>
+      <dc:subject>
+        <rdf:Bag>
+          <rdf:li>street</rdf:li>
+          <rdf:li>tokyo</rdf:li>
+        </rdf:Bag>
+      </dc:subject>
+      <dc:rights>
+        <rdf:Alt>
+          <rdf:li xml:lang="x-default">Author</rdf:li>
+        </rdf:Alt>
+      </dc:rights>
+    </rdf:Description>
+  </rdf:RDF>
+</x:xmpmeta>
+<?xpacket end="w"?>`
+
+func TestGetMetadata(t *testing.T) {
+	meta, err := GetMetadata(testdata.MetadataTestFile)
+	assert.Nil(t, err)
+
+	assert.Equal(t, testdata.ExpectedMake, meta.EXIF["Make"])
+	assert.Equal(t, testdata.ExpectedImageDescription, meta.IPTC["Caption-Abstract"])
+	assert.Equal(t, testdata.ExpectedImageDescription, meta.XMP["Description"])
+	assert.Equal(t, testdata.ExpectedXMPLens, meta.XMP["Lens"])
+
+	rotated, err := GetMetadata(testdata.RotatedImageFile)
+	assert.Nil(t, err)
+	assert.Less(t, 4, rotated.Orientation)
+
+	_, err = GetMetadata("nonexisting-file.jpg")
+	assert.True(t, os.IsNotExist(err))
+}
+
+func TestGetMetadataWithSidecar(t *testing.T) {
+	tmp, err := os.MkdirTemp("", "foto-test")
+	assert.Nil(t, err)
+	defer os.RemoveAll(tmp)
+
+	path := filepath.Join(tmp, "photo.jpg")
+	_ = cp.Copy(testdata.MetadataTestFile, path)
+	_ = files.WriteDataToFile([]byte(testXMP), filepath.Join(tmp, "photo.xmp"))
+
+	meta, err := GetMetadata(path)
+	assert.Nil(t, err)
+
+	// embedded values are kept unless the sidecar has them
+	assert.Equal(t, testdata.ExpectedXMPLens, meta.XMP["Lens"])
+	assert.Equal(t, "Sidecar title", meta.XMP["Title"])
+	assert.Equal(t, "5", meta.XMP["Rating"])
+}
+
+func TestParseXMP(t *testing.T) {
+	tags, err := parseXMP([]byte(testXMP))
+	assert.Nil(t, err)
+	assert.Equal(t, map[string]string{
+		"Rating":  "5",
+		"Title":   "Sidecar title",
+		"Subject": "street, tokyo",
+		"Rights":  "Author",
+	}, tags)
+
+	_, err = parseXMP([]byte("<x:xmpmeta"))
+	assert.NotNil(t, err)
+}
+
+func TestXMPSidecarPath(t *testing.T) {
+	tmp, err := os.MkdirTemp("", "foto-test")
+	assert.Nil(t, err)
+	defer os.RemoveAll(tmp)
+
+	path := filepath.Join(tmp, "photo.jpg")
+	assert.Equal(t, "", XMPSidecarPath(path))
+
+	_ = files.WriteDataToFile([]byte(testXMP), filepath.Join(tmp, "photo.xmp"))
+	assert.Equal(t, filepath.Join(tmp, "photo.xmp"), XMPSidecarPath(path))
+
+	_ = files.WriteDataToFile([]byte(testXMP), filepath.Join(tmp, "photo.jpg.xmp"))
+	assert.Equal(t, filepath.Join(tmp, "photo.jpg.xmp"), XMPSidecarPath(path))
+}
+
+func TestGetMetadataInfo(t *testing.T) {
+	meta, err := GetMetadata(testdata.MetadataTestFile)
+	assert.Nil(t, err)
+
+	info := meta.Info
+	assert.Equal(t, testdata.ExpectedMake, info.Make)
+	assert.Equal(t, "FUJIFILM GFX 50R", info.Camera())
+	assert.Equal(t, "GF50mmF3.5 R LM WR", info.Lens)
+	assert.Equal(t, "50mm", info.FormattedFocalLength())
+	assert.Equal(t, "f/8", info.FormattedAperture())
+	assert.Equal(t, "1/340s", info.FormattedExposureTime())
+	assert.Equal(t, "ISO 100", info.FormattedISO())
+	assert.Equal(t, "2022-06-26 14:37", info.FormattedCaptureTime("2006-01-02 15:04"))
+	assert.True(t, info.HasGPS)
+	assert.InDelta(t, 35.6974, info.Latitude, 0.0001)
+	assert.InDelta(t, 139.9849, info.Longitude, 0.0001)
+}
+
+func TestGetMetadataEmptyInfo(t *testing.T) {
+	meta, err := GetMetadata(testdata.Testfile)
+	assert.Nil(t, err)
+
+	info := meta.Info
+	assert.Equal(t, "", info.Camera())
+	assert.Equal(t, "", info.FormattedFocalLength())
+	assert.Equal(t, "", info.FormattedAperture())
+	assert.Equal(t, "", info.FormattedExposureTime())
+	assert.Equal(t, "", info.FormattedISO())
+	assert.Equal(t, "", info.FormattedCaptureTime(time.RFC3339))
+	assert.False(t, info.HasGPS)
+}
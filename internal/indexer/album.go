@@ -0,0 +1,109 @@
+package indexer
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/rs/zerolog/log"
+	"github.com/waynezhang/foto/internal/config"
+)
+
+// File describing a sub-album, placed in its folder
+const albumMetadataFileName = "album.toml"
+
+// Title, description and slug of a sub-album, defaulting to values derived from the folder name
+type AlbumMetadata struct {
+	Title    string `toml:"title"`
+	Text     string `toml:"text"`
+	TextFile string `toml:"textFile"`
+	// Appended to the slug of the parent, e.g. `parent-slug`
+	Slug string `toml:"slug"`
+}
+
+// The section followed by all of its sub-albums, depth first
+func (s Section) Albums() []Section {
+	albums := []Section{s}
+	for _, child := range s.Children {
+		albums = append(albums, child.Albums()...)
+	}
+	return albums
+}
+
+// The section or the first sub-album with photos, for its cover image. Nil if none.
+func (s Section) CoverAlbum() *Section {
+	for _, album := range s.Albums() {
+		if len(album.ImageSets) > 0 {
+			return &album
+		}
+	}
+	return nil
+}
+
+// All sections including sub-albums, depth first
+func Flatten(sections []Section) []Section {
+	albums := []Section{}
+	for _, s := range sections {
+		albums = append(albums, s.Albums()...)
+	}
+	return albums
+}
+
+// Metadata of the sub-albums of `parent`, one per subdirectory in name order
+func childAlbums(parent config.SectionMetadata) []config.SectionMetadata {
+	entries, err := os.ReadDir(parent.Folder)
+	if err != nil {
+		log.Warn().Msgf("Failed to read folder %s (%v)", parent.Folder, err)
+		return nil
+	}
+
+	children := []config.SectionMetadata{}
+	for _, entry := range entries {
+		if !entry.IsDir() || strings.HasPrefix(entry.Name(), ".") {
+			continue
+		}
+
+		folder := filepath.Join(parent.Folder, entry.Name())
+		album := loadAlbumMetadata(folder)
+
+		child := parent
+		child.Folder = folder
+		child.Title = album.Title
+		child.Text = album.Text
+		child.TextFile = album.TextFile
+		child.Slug = parent.Slug + "-" + album.Slug
+		children = append(children, child)
+	}
+	return children
+}
+
+func loadAlbumMetadata(folder string) AlbumMetadata {
+	album := AlbumMetadata{}
+	path := filepath.Join(folder, albumMetadataFileName)
+	if _, err := os.Stat(path); err == nil {
+		if err := decodeMetadataFile(path, &album); err != nil {
+			log.Warn().Msgf("Failed to parse album file %s (%v)", path, err)
+		}
+	}
+
+	name := filepath.Base(folder)
+	if album.Title == "" {
+		album.Title = name
+	}
+	if album.Slug == "" {
+		album.Slug = slugify(name)
+	}
+	if album.Slug == "" {
+		// e.g. folder names without any ASCII letter
+		album.Slug = fmt.Sprintf("album-%x", name)
+	}
+	return album
+}
+
+var invalidSlugCharacters = regexp.MustCompile("[^a-z0-9_]+")
+
+func slugify(name string) string {
+	return strings.Trim(invalidSlugCharacters.ReplaceAllString(strings.ToLower(name), "-"), "-")
+}
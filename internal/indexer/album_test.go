@@ -0,0 +1,104 @@
+package indexer
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	cp "github.com/otiai10/copy"
+	"github.com/stretchr/testify/assert"
+	"github.com/waynezhang/foto/internal/config"
+	"github.com/waynezhang/foto/internal/files"
+	"github.com/waynezhang/foto/internal/testdata"
+)
+
+func prepareAlbums(t *testing.T) string {
+	tmp, err := os.MkdirTemp("", "foto-test")
+	assert.Nil(t, err)
+
+	_ = cp.Copy(testdata.Testfile, filepath.Join(tmp, "root.jpg"))
+	_ = cp.Copy(testdata.Testfile, filepath.Join(tmp, "Trip 2024", "trip.jpg"))
+	_ = cp.Copy(testdata.Testfile, filepath.Join(tmp, "tokyo", "shibuya", "shibuya.jpg"))
+	_ = files.WriteDataToFile([]byte(`
+title = "Tokyo"
+text = "Photos of Tokyo"
+slug = "tyo"
+`), filepath.Join(tmp, "tokyo", albumMetadataFileName))
+	_ = files.EnsureDirectory(filepath.Join(tmp, "empty"))
+
+	return tmp
+}
+
+func TestBuildSubAlbums(t *testing.T) {
+	tmp := prepareAlbums(t)
+	defer os.RemoveAll(tmp)
+
+	meta := config.SectionMetadata{Title: "Root", Slug: "root", Folder: tmp, SubAlbums: true}
+	sections, err := Build([]config.SectionMetadata{meta}, defaultOption, nil)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(sections))
+
+	root := sections[0]
+	assert.Equal(t, []string{"root.jpg"}, fileNames(root.ImageSets))
+	assert.Equal(t, 2, len(root.Children))
+
+	trip := root.Children[0]
+	assert.Equal(t, "Trip 2024", trip.Title)
+	assert.Equal(t, "root-trip-2024", trip.Slug)
+	assert.Equal(t, 1, trip.Depth)
+	assert.Equal(t, []string{"trip.jpg"}, fileNames(trip.ImageSets))
+
+	tokyo := root.Children[1]
+	assert.Equal(t, "Tokyo", tokyo.Title)
+	assert.Equal(t, "<p>Photos of Tokyo</p>\n", string(tokyo.Text))
+	assert.Equal(t, "root-tyo", tokyo.Slug)
+	assert.Equal(t, 0, len(tokyo.ImageSets))
+	assert.Equal(t, "root-tyo-shibuya", tokyo.Children[0].Slug)
+	assert.Equal(t, 2, tokyo.Children[0].Depth)
+	assert.Equal(t, "root-tyo-shibuya", tokyo.CoverAlbum().Slug)
+
+	slugs := []string{}
+	for _, s := range Flatten(sections) {
+		slugs = append(slugs, s.Slug)
+	}
+	assert.Equal(t, []string{"root", "root-trip-2024", "root-tyo", "root-tyo-shibuya"}, slugs)
+}
+
+func TestBuildWithoutSubAlbums(t *testing.T) {
+	tmp := prepareAlbums(t)
+	defer os.RemoveAll(tmp)
+
+	meta := config.SectionMetadata{Title: "Root", Slug: "root", Folder: tmp}
+	sections, err := Build([]config.SectionMetadata{meta}, defaultOption, nil)
+	assert.Nil(t, err)
+	assert.Equal(t, 3, len(sections[0].ImageSets))
+	assert.Equal(t, 0, len(sections[0].Children))
+}
+
+func TestBuildSubAlbumsDuplicatedSlugs(t *testing.T) {
+	tmp := prepareAlbums(t)
+	defer os.RemoveAll(tmp)
+
+	meta := config.SectionMetadata{Title: "Root", Slug: "root", Folder: tmp, SubAlbums: true}
+	other := config.SectionMetadata{Title: "Other", Slug: "root-tyo", Folder: testdata.Collection1["folder"].(string)}
+	_, err := Build([]config.SectionMetadata{meta, other}, defaultOption, nil)
+	assert.NotNil(t, err)
+}
+
+func TestBuildSubAlbumsInvalidSlug(t *testing.T) {
+	tmp := prepareAlbums(t)
+	defer os.RemoveAll(tmp)
+
+	_ = files.WriteDataToFile([]byte(`slug = "My Sub/../x"`), filepath.Join(tmp, "tokyo", albumMetadataFileName))
+
+	meta := config.SectionMetadata{Title: "Root", Slug: "root", Folder: tmp, SubAlbums: true}
+	_, err := Build([]config.SectionMetadata{meta}, defaultOption, nil)
+	assert.ErrorContains(t, err, "is invalid")
+}
+
+func TestSlugify(t *testing.T) {
+	assert.Equal(t, "trip-2024", slugify("Trip 2024"))
+	assert.Equal(t, "a_b-c", slugify("--A_b.c--"))
+	assert.Equal(t, "", slugify("東京"))
+	assert.True(t, config.ValidSlug(loadAlbumMetadata("東京").Slug))
+}
@@ -0,0 +1,47 @@
+package indexer
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"path/filepath"
+	"strings"
+
+	"github.com/rs/zerolog/log"
+)
+
+// Assigns unique output names to photos sharing a file name in different subfolders.
+// The name gets a short hash of the relative path so it is stable across builds,
+// e.g. `IMG_0001-1a2b3c4d.jpg`. Names are compared case-insensitively for
+// case-insensitive file systems.
+func resolveCollisions(sets []ImageSet) {
+	groups := map[string][]int{}
+	for i, set := range sets {
+		key := strings.ToLower(set.FileName)
+		groups[key] = append(groups[key], i)
+	}
+
+	for _, indexes := range groups {
+		if len(indexes) < 2 {
+			continue
+		}
+
+		paths := []string{}
+		for _, i := range indexes {
+			set := &sets[i]
+			set.OutputName = uniqueOutputName(set.OutputName, set.Path)
+			for j := range set.Variants {
+				set.Variants[j].FileName = set.Variants[j].Format.FileName(set.OutputName)
+			}
+			paths = append(paths, set.Path)
+		}
+		log.Warn().Msgf("Photos %s share the same file name, exported with unique names instead.", strings.Join(paths, ", "))
+	}
+}
+
+func uniqueOutputName(name string, relativePath string) string {
+	if name == "" {
+		name = filepath.Base(relativePath)
+	}
+	sum := sha256.Sum256([]byte(filepath.ToSlash(relativePath)))
+	return appendToName(name, hex.EncodeToString(sum[:4]))
+}
@@ -0,0 +1,52 @@
+package indexer
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	cp "github.com/otiai10/copy"
+	"github.com/stretchr/testify/assert"
+	"github.com/waynezhang/foto/internal/images"
+	"github.com/waynezhang/foto/internal/testdata"
+)
+
+func TestResolveCollisions(t *testing.T) {
+	sets := []ImageSet{
+		{FileName: "IMG_0001.jpg", Path: "a/IMG_0001.jpg", OutputName: "IMG_0001.jpg", Variants: buildVariants("IMG_0001.jpg", []images.Format{images.FormatWebP, images.FormatJPEG})},
+		{FileName: "img_0001.jpg", Path: "b/img_0001.jpg", OutputName: "img_0001.jpg", Variants: buildVariants("img_0001.jpg", images.DefaultFormats)},
+		{FileName: "IMG_0002.jpg", Path: "a/IMG_0002.jpg", OutputName: "IMG_0002.jpg", Variants: buildVariants("IMG_0002.jpg", images.DefaultFormats)},
+	}
+
+	resolveCollisions(sets)
+
+	assert.Equal(t, uniqueOutputName("IMG_0001.jpg", "a/IMG_0001.jpg"), sets[0].OutputName)
+	assert.Regexp(t, `^IMG_0001-[0-9a-f]{8}\.jpg$`, sets[0].OutputName)
+	assert.Equal(t, sets[0].OutputName+".webp", sets[0].Variants[0].FileName)
+	assert.Equal(t, sets[0].OutputName, sets[0].Variants[1].FileName)
+
+	assert.Regexp(t, `^img_0001-[0-9a-f]{8}\.jpg$`, sets[1].OutputName)
+	assert.NotEqual(t, sets[0].OutputName, sets[1].OutputName)
+
+	assert.Equal(t, "IMG_0002.jpg", sets[2].OutputName)
+	assert.Equal(t, "IMG_0002.jpg", sets[2].Variants[0].FileName)
+}
+
+func TestBuildImageSetsCollisions(t *testing.T) {
+	tmp, _ := os.MkdirTemp("", "foto-test")
+	defer os.RemoveAll(tmp)
+
+	_ = cp.Copy(testdata.Testfile, filepath.Join(tmp, "a", "photo.jpg"))
+	_ = cp.Copy(testdata.Testfile, filepath.Join(tmp, "b", "photo.jpg"))
+
+	sets := buildImageSets(tmp, true, "", true, defaultOption, nil)
+	assert.Equal(t, 2, len(sets))
+	assert.Equal(t, filepath.Join("a", "photo.jpg"), sets[0].Path)
+	assert.Equal(t, filepath.Join(tmp, "b", "photo.jpg"), sets[1].SourcePath(tmp))
+	assert.NotEqual(t, sets[0].FallbackVariant().FileName, sets[1].FallbackVariant().FileName)
+
+	// Stable across builds
+	again := buildImageSets(tmp, true, "", true, defaultOption, nil)
+	assert.Equal(t, sets[0].OutputName, again[0].OutputName)
+	assert.Equal(t, sets[1].OutputName, again[1].OutputName)
+}
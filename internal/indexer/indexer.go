@@ -5,13 +5,17 @@ import (
 	"html/template"
 	"os"
 	"path/filepath"
-	"regexp"
-	"sort"
+	"slices"
 	"sync"
+	"time"
 
 	"github.com/rs/zerolog/log"
+	"github.com/waynezhang/foto/internal/cache"
 	"github.com/waynezhang/foto/internal/config"
+	"github.com/waynezhang/foto/internal/files"
 	"github.com/waynezhang/foto/internal/images"
+	"github.com/waynezhang/foto/internal/markdown"
+	"github.com/waynezhang/foto/internal/workers"
 )
 
 type Section struct {
@@ -20,122 +24,385 @@ type Section struct {
 	Slug      string
 	Folder    string
 	Ascending bool
+	Sort      string
+	// Photos per page of the section page, 0 for a single page
+	PageSize  int
 	ImageSets []ImageSet
+	// Sub-albums built from subdirectories when `subAlbums` is enabled
+	Children []Section
+	// 0 for sections in the config file, incremented for each level of sub-albums
+	Depth int
+}
+
+// The first photo of the section, nil if empty
+func (s Section) Cover() *ImageSet {
+	if len(s.ImageSets) == 0 {
+		return nil
+	}
+	return &s.ImageSets[0]
 }
 
 type ImageSet struct {
-	FileName        string
+	FileName string
+	// Relative to the section folder, differs from `FileName` for photos in subfolders
+	Path string
+	// Base of output file names, differs from `FileName` when it collides with another photo in the section
+	OutputName      string
 	ThumbnailSize   images.ImageSize
 	OriginalSize    images.ImageSize
 	CompressQuality int
 	EXIF            map[string]string
+	IPTC            map[string]string
+	XMP             map[string]string
+	ModTime         time.Time
+	// Typed shooting information normalized from EXIF
+	Info images.PhotoInfo
+	// One variant per configured output format, in the configured order of preference
+	Variants []ImageVariant
+	// Additional thumbnails for `srcset`, ordered by width
+	Thumbnails []ImageRendition
+
+	// From sidecar metadata files
+	Title   string
+	Caption string
+	Alt     string
+	Tags    []string
+	Weight  int
+}
+
+// Thumbnail rendered at one of the configured widths
+type ImageRendition struct {
+	// Folder of the rendition in the output and in URLs, e.g. `thumbnail-320`
+	Key  string
+	Size images.ImageSize
+}
+
+// Rendition of an image in one output format, shared by thumbnail and original
+type ImageVariant struct {
+	Format   images.Format
+	MIMEType string
+	FileName string
+	// URL relative to the site root keyed by rendition, e.g. `thumbnail`, `original` or `thumbnail-320`
+	URLs map[string]string
+}
+
+// Variants to be written, falling back to JPEG when none are recorded
+func (set ImageSet) OutputVariants() []ImageVariant {
+	if len(set.Variants) == 0 {
+		name := set.OutputName
+		if name == "" {
+			name = set.FileName
+		}
+		return buildVariants(name, images.DefaultFormats)
+	}
+	return set.Variants
 }
 
-func Build(metadata []config.SectionMetadata, option config.ExtractOption) ([]Section, error) {
+// URL of the fallback thumbnail relative to the site root
+func (set ImageSet) ThumbnailURL() string {
+	return set.FallbackVariant().URLs["thumbnail"]
+}
+
+// URL of the fallback original relative to the site root
+func (set ImageSet) OriginalURL() string {
+	return set.FallbackVariant().URLs["original"]
+}
+
+// Path of the source photo in the section `folder`
+func (set ImageSet) SourcePath(folder string) string {
+	if set.Path == "" {
+		return filepath.Join(folder, set.FileName)
+	}
+	return filepath.Join(folder, set.Path)
+}
+
+// The last configured variant, used where only one file can be referenced
+func (set ImageSet) FallbackVariant() ImageVariant {
+	variants := set.OutputVariants()
+	return variants[len(variants)-1]
+}
+
+// Builds sections of photos, reusing records of unchanged photos in `index` unless it's nil
+func Build(metadata []config.SectionMetadata, option config.ExtractOption, index cache.Cache) ([]Section, error) {
 	sections := []Section{}
 	slugs := map[string]bool{}
 
+	if _, err := images.ParseFormats(option.Formats); err != nil {
+		return nil, fmt.Errorf("Image format is invalid (%v). Supported formats are jpeg, png, webp and avif.", err)
+	}
+
 	for _, val := range metadata {
 		slug := val.Slug
-		if !validSlug(slug) {
+		if !config.ValidSlug(slug) {
 			return nil, fmt.Errorf("Slug \"%s\" is invalid. Only letters([a-zA-Z]), numbers([09-]), underscore(_) and hyphen(-) can be used.", slug)
 		}
 		if slugs[slug] {
 			return nil, fmt.Errorf("Slug \"%s\" already exists. Slug needs to be unique.", slug)
 		}
+		if val.PageSize < 0 {
+			return nil, fmt.Errorf("Page size %d of section \"%s\" is invalid. It needs to be positive, or 0 to disable pagination.", val.PageSize, slug)
+		}
+		if !config.ValidSort(val.Sort) {
+			return nil, fmt.Errorf("Sort \"%s\" of section \"%s\" is invalid. Supported values are filename, mtime, manual and exif:<tag>.", val.Sort, slug)
+		}
+		if val.TextFile != "" && !files.IsExisting(textFilePath(val)) {
+			return nil, fmt.Errorf("Text file %s of section \"%s\" is not found.", textFilePath(val), slug)
+		}
 
-		log.Debug().Msgf("Extacting section [%s][/%s] %s", val.Title, val.Slug, val.Folder)
-
-		sectionOption := sectionExtractOption(option, val)
-		s := Section{
-			Title:     val.Title,
-			Text:      val.Text,
-			Slug:      slug,
-			Folder:    val.Folder,
-			Ascending: val.Ascending,
-			ImageSets: buildImageSets(val.Folder, val.Ascending, sectionOption),
+		s := buildSection(val, sectionExtractOption(option, val), 0, index)
+		for _, album := range s.Albums() {
+			// Slugs of sub-albums can come from album.toml and become paths of the output
+			if !config.ValidSlug(album.Slug) {
+				return nil, fmt.Errorf("Slug \"%s\" of album %s is invalid. Only letters([a-zA-Z]), numbers([09-]), underscore(_) and hyphen(-) can be used.", album.Slug, album.Folder)
+			}
+			if slugs[album.Slug] {
+				return nil, fmt.Errorf("Slug \"%s\" of album %s already exists. Slug needs to be unique.", album.Slug, album.Folder)
+			}
+			slugs[album.Slug] = true
 		}
-		slugs[slug] = true
 
-		if len(s.ImageSets) > 0 {
+		if len(s.ImageSets) > 0 || len(s.Children) > 0 {
 			sections = append(sections, s)
 		}
 	}
 
+	if index != nil {
+		if err := index.Save(); err != nil {
+			log.Warn().Msgf("Failed to save index cache (%v)", err)
+		}
+	}
+
 	return sections, nil
 }
 
-func buildImageSets(folder string, ascending bool, option config.ExtractOption) []ImageSet {
+// Section text and text file rendered from Markdown
+func sectionText(val config.SectionMetadata) template.HTML {
+	source := val.Text
+	if val.TextFile != "" {
+		data, err := os.ReadFile(textFilePath(val))
+		if err != nil {
+			log.Warn().Msgf("Failed to read text file %s (%v)", textFilePath(val), err)
+		} else {
+			source += "\n\n" + string(data)
+		}
+	}
+
+	text, err := markdown.Render(source)
+	if err != nil {
+		log.Warn().Msgf("Failed to render text of section %s (%v)", val.Slug, err)
+		return ""
+	}
+	return text
+}
+
+// `textFile` is relative to the section folder
+func textFilePath(val config.SectionMetadata) string {
+	if filepath.IsAbs(val.TextFile) {
+		return val.TextFile
+	}
+	return filepath.Join(val.Folder, val.TextFile)
+}
+
+func buildSection(val config.SectionMetadata, option config.ExtractOption, depth int, index cache.Cache) Section {
+	log.Debug().Msgf("Extacting section [%s][/%s] %s", val.Title, val.Slug, val.Folder)
+
+	s := Section{
+		Title:     val.Title,
+		Text:      sectionText(val),
+		Slug:      val.Slug,
+		Folder:    val.Folder,
+		Ascending: val.Ascending,
+		Sort:      val.Sort,
+		PageSize:  val.PageSize,
+		ImageSets: buildImageSets(val.Folder, !val.SubAlbums, val.Sort, val.Ascending, option, index),
+		Depth:     depth,
+	}
+	assignURLs(s.ImageSets, s.Slug)
+
+	if val.SubAlbums {
+		for _, child := range childAlbums(val) {
+			c := buildSection(child, option, depth+1, index)
+			if len(c.ImageSets) > 0 || len(c.Children) > 0 {
+				s.Children = append(s.Children, c)
+			}
+		}
+	}
+
+	return s
+}
+
+// Photos in `folder`, including subdirectories when `recursive`
+func buildImageSets(folder string, recursive bool, sortBy string, ascending bool, option config.ExtractOption, index cache.Cache) []ImageSet {
 	sets := []ImageSet{}
 
-	wg := &sync.WaitGroup{}
+	g := workers.Shared().Group()
 	mutext := &sync.Mutex{}
+	metadata := newMetadataLoader()
 
 	_ = filepath.WalkDir(folder, func(path string, info os.DirEntry, err error) error {
 		if err != nil {
 			log.Warn().Msgf("Failed to extract info from %s (%v)", path, err)
 			return nil
 		}
-		if info.IsDir() || !images.IsPhotoSupported(path) {
+		if info.IsDir() {
+			if !recursive && path != folder {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !images.IsPhotoSupported(path) {
 			return nil
 		}
 
-		wg.Add(1)
-
-		go func(src string) {
-			defer wg.Done()
-
-			s, err := buildImageSet(src, option)
+		src := path
+		// Only headers and metadata are read, decoding is left to export and preview
+		g.Go(0, func() {
+			s, err := buildImageSet(src, option, metadata, index)
 			if s != nil {
+				s.Path, _ = filepath.Rel(folder, src)
 				mutext.Lock()
 				sets = append(sets, *s)
 				mutext.Unlock()
 			} else {
 				log.Warn().Msgf("Failed to extract info from %s (%v)", src, err)
 			}
-		}(path)
+		})
 
 		return nil
 	})
-	wg.Wait()
+	g.Wait()
 
-	sort.SliceStable(sets, func(i, j int) bool {
-		if ascending {
-			return sets[i].FileName < sets[j].FileName
-		} else {
-			return sets[i].FileName > sets[j].FileName
-		}
-	})
+	resolveCollisions(sets)
+	sortImageSets(sets, folder, sortBy, ascending)
 
 	return sets
 }
 
-func buildImageSet(path string, option config.ExtractOption) (*ImageSet, error) {
-	imageSize, err := images.GetPhotoSize(path)
+func buildImageSet(path string, option config.ExtractOption, metadata *metadataLoader, index cache.Cache) (*ImageSet, error) {
+	record, err := indexRecord(path, index)
 	if err != nil {
 		return nil, err
 	}
+	imageSize := record.ImageSize
+	embedded := record.Metadata
 
-	thumbnailSize := images.AspectedSize(*imageSize, option.ThumbnailWidth, option.MinThumbnailHeight)
-	originalSize := images.AspectedSize(*imageSize, option.OriginalWidth, option.MinOriginalHeight)
+	thumbnailSize := images.AspectedSize(imageSize, option.ThumbnailWidth, option.MinThumbnailHeight)
+	originalSize := images.AspectedSize(imageSize, option.OriginalWidth, option.MinOriginalHeight)
 
-	exif, err := images.GetEXIFValues(path)
+	formats, err := images.ParseFormats(option.Formats)
 	if err != nil {
 		return nil, err
 	}
 
-	return &ImageSet{
+	meta := metadata.load(path)
+
+	stat, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+
+	set := &ImageSet{
 		FileName:        filepath.Base(path),
+		OutputName:      filepath.Base(path),
 		ThumbnailSize:   thumbnailSize,
 		OriginalSize:    originalSize,
 		CompressQuality: option.CompressQuality,
-		EXIF:            exif,
-	}, nil
+		EXIF:            embedded.EXIF,
+		IPTC:            embedded.IPTC,
+		XMP:             embedded.XMP,
+		ModTime:         stat.ModTime(),
+		Info:            embedded.Info,
+		Variants:        buildVariants(path, formats),
+		Thumbnails:      buildThumbnails(imageSize, option.ThumbnailWidths),
+		Title:           meta.Title,
+		Caption:         meta.Caption,
+		Alt:             meta.Alt,
+		Tags:            meta.Tags,
+		Weight:          meta.Weight,
+	}
+
+	if option.HashFileNames {
+		checksum, err := sourceChecksum(path, index)
+		if err != nil {
+			return nil, err
+		}
+		name := contentHashedName(checksum, *set)
+		set.OutputName = name
+		set.Variants = buildVariants(name, formats)
+	}
+
+	return set, nil
 }
 
-func validSlug(slug string) bool {
-	matched, _ := regexp.MatchString("^[a-zA-Z0-9-_]+$", slug)
-	return matched
+// Size and embedded metadata of the photo, read from `index` when the photo is unchanged
+func indexRecord(path string, index cache.Cache) (*cache.IndexRecord, error) {
+	if index != nil {
+		if record := index.IndexRecord(path); record != nil {
+			return record, nil
+		}
+	}
+
+	embedded, err := images.GetMetadata(path)
+	if err != nil {
+		return nil, err
+	}
+
+	imageSize, err := images.GetOrientedPhotoSize(path, embedded.Orientation)
+	if err != nil {
+		return nil, err
+	}
+
+	record := &cache.IndexRecord{ImageSize: *imageSize, Metadata: *embedded}
+	if index != nil {
+		index.AddIndexRecord(path, *record)
+	}
+	return record, nil
+}
+
+// Checksum of the photo, memoized by `index` when set
+func sourceChecksum(path string, index cache.Cache) (string, error) {
+	var checksum *string
+	var err error
+	if index != nil {
+		checksum, err = index.Checksum(path)
+	} else {
+		checksum, err = files.Checksum(path)
+	}
+	if err != nil {
+		return "", err
+	}
+	return *checksum, nil
+}
+
+func buildThumbnails(size images.ImageSize, widths []int) []ImageRendition {
+	sorted := slices.Clone(widths)
+	slices.Sort(sorted)
+	sorted = slices.Compact(sorted)
+
+	thumbnails := []ImageRendition{}
+	for _, width := range sorted {
+		// Upscaled thumbnails are useless for srcset
+		if width <= 0 || width > size.Width {
+			continue
+		}
+		thumbnails = append(thumbnails, ImageRendition{
+			Key:  fmt.Sprintf("thumbnail-%d", width),
+			Size: images.AspectedSize(size, width, 0),
+		})
+	}
+	return thumbnails
+}
+
+func buildVariants(path string, formats []images.Format) []ImageVariant {
+	variants := []ImageVariant{}
+	for _, f := range formats {
+		variants = append(variants, ImageVariant{
+			Format:   f,
+			MIMEType: f.MIMEType(),
+			FileName: f.FileName(path),
+		})
+	}
+	return variants
 }
 
 func sectionExtractOption(global config.ExtractOption, metadata config.SectionMetadata) config.ExtractOption {
@@ -152,6 +419,9 @@ func sectionExtractOption(global config.ExtractOption, metadata config.SectionMe
 	if metadata.MinOriginalHeight > 0 {
 		sectionOption.MinOriginalHeight = metadata.MinOriginalHeight
 	}
+	if len(metadata.ThumbnailWidths) > 0 {
+		sectionOption.ThumbnailWidths = metadata.ThumbnailWidths
+	}
 
 	return sectionOption
 }
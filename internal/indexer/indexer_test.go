@@ -1,14 +1,19 @@
 package indexer
 
 import (
+	"fmt"
 	"html/template"
 	"os"
 	"path/filepath"
 	"testing"
 
 	"github.com/mitchellh/mapstructure"
+	cp "github.com/otiai10/copy"
 	"github.com/stretchr/testify/assert"
+	"github.com/waynezhang/foto/internal/cache"
 	"github.com/waynezhang/foto/internal/config"
+	"github.com/waynezhang/foto/internal/files"
+	"github.com/waynezhang/foto/internal/images"
 	"github.com/waynezhang/foto/internal/testdata"
 )
 
@@ -20,14 +25,6 @@ var (
 	}
 )
 
-func TestValidSlug(t *testing.T) {
-	assert.True(t, validSlug("abcde-efg_9999"))
-	assert.False(t, validSlug("abcde efg_9999"))
-	assert.False(t, validSlug("abcde-efgかたかな"))
-	assert.False(t, validSlug("abcde.efg_999"))
-	assert.False(t, validSlug(""))
-}
-
 func TestBuild(t *testing.T) {
 	var meta1 config.SectionMetadata
 	var meta2 config.SectionMetadata
@@ -36,11 +33,11 @@ func TestBuild(t *testing.T) {
 
 	data := []config.SectionMetadata{meta1, meta2}
 
-	sections, _ := Build(data, defaultOption)
+	sections, _ := Build(data, defaultOption, nil)
 	assert.Equal(t, 2, len(sections))
 	assert.Equal(t, testdata.Collection1["title"], sections[0].Title)
 
-	assert.Equal(t, template.HTML("This is Section 1"), sections[0].Text)
+	assert.Equal(t, template.HTML("<p>This is Section 1</p>\n"), sections[0].Text)
 
 	assert.Equal(t, 3, len(sections[0].ImageSets))
 	assert.Equal(t, testdata.Collection1FileName1, sections[0].ImageSets[0].FileName)
@@ -56,7 +53,7 @@ func TestBuildSizeOverride(t *testing.T) {
 
 	data := []config.SectionMetadata{meta1, meta2}
 
-	sections, _ := Build(data, defaultOption)
+	sections, _ := Build(data, defaultOption, nil)
 	assert.Equal(t, 640, sections[0].ImageSets[0].ThumbnailSize.Width)
 	assert.Equal(t, 480, sections[0].ImageSets[0].ThumbnailSize.Height)
 	assert.Equal(t, 2048, sections[0].ImageSets[0].OriginalSize.Width)
@@ -77,7 +74,7 @@ func TestBuildDuplicatedSlugs(t *testing.T) {
 
 	data := []config.SectionMetadata{meta1, meta2}
 
-	_, err := Build(data, defaultOption)
+	_, err := Build(data, defaultOption, nil)
 	assert.NotNil(t, err)
 }
 
@@ -89,7 +86,7 @@ func TestBuildEmptySection(t *testing.T) {
 
 	data := []config.SectionMetadata{meta, emptyMeta}
 
-	sections, _ := Build(data, defaultOption)
+	sections, _ := Build(data, defaultOption, nil)
 	assert.Equal(t, 1, len(sections))
 	assert.Equal(t, testdata.Collection1["title"], sections[0].Title)
 }
@@ -108,14 +105,14 @@ func TestBuildImageSets(t *testing.T) {
 
 	folder := testdata.Collection1["folder"].(string)
 
-	sets := buildImageSets(folder, true, defaultOption)
+	sets := buildImageSets(folder, true, "", true, defaultOption, nil)
 	assert.Equal(t, expectedAscendingFileNames, []string{
 		sets[0].FileName,
 		sets[1].FileName,
 		sets[2].FileName,
 	})
 
-	sets = buildImageSets(folder, false, defaultOption)
+	sets = buildImageSets(folder, true, "", false, defaultOption, nil)
 	assert.Equal(t, expectedDesendingFileNames, []string{
 		sets[0].FileName,
 		sets[1].FileName,
@@ -123,15 +120,41 @@ func TestBuildImageSets(t *testing.T) {
 	})
 }
 
+func TestBuildImageSetsWeight(t *testing.T) {
+	tmp, _ := os.MkdirTemp("", "foto-test")
+	defer os.RemoveAll(tmp)
+
+	folder := testdata.Collection1["folder"].(string)
+	_ = cp.Copy(folder, tmp)
+	_ = files.WriteDataToFile([]byte(fmt.Sprintf(`
+["%s"]
+weight = 2
+
+["%s"]
+weight = 1
+`, testdata.Collection1FileName1, testdata.Collection1FileName3)), filepath.Join(tmp, folderMetadataFileName))
+
+	sets := buildImageSets(tmp, true, "", true, defaultOption, nil)
+	assert.Equal(t, []string{
+		testdata.Collection1FileName3,
+		testdata.Collection1FileName1,
+		testdata.Collection1FileName2,
+	}, []string{
+		sets[0].FileName,
+		sets[1].FileName,
+		sets[2].FileName,
+	})
+}
+
 func TestInvalidBuildImageSets(t *testing.T) {
 	tmp, _ := os.MkdirTemp("", "foto-test")
 	path := filepath.Join(tmp, "folder-not-exist")
 	// no crash expected
-	_ = buildImageSets(path, true, defaultOption)
+	_ = buildImageSets(path, true, "", true, defaultOption, nil)
 }
 
 func TestBuildImageSet(t *testing.T) {
-	set, _ := buildImageSet(testdata.Testfile, defaultOption)
+	set, _ := buildImageSet(testdata.Testfile, defaultOption, newMetadataLoader(), nil)
 	assert.Equal(t, filepath.Base(testdata.Testfile), set.FileName)
 	assert.Equal(t, testdata.ThumbnailWidth, set.ThumbnailSize.Width)
 	assert.Equal(t, testdata.ThumbnailHeight, set.ThumbnailSize.Height)
@@ -140,6 +163,124 @@ func TestBuildImageSet(t *testing.T) {
 	assert.Equal(t, testdata.CompressQuality, set.CompressQuality)
 }
 
+func TestBuildImageSetMetadata(t *testing.T) {
+	set, err := buildImageSet(testdata.MetadataTestFile, defaultOption, newMetadataLoader(), nil)
+	assert.Nil(t, err)
+	assert.Equal(t, testdata.ExpectedMake, set.EXIF["Make"])
+	assert.Equal(t, testdata.ExpectedImageDescription, set.IPTC["Caption-Abstract"])
+	assert.Equal(t, testdata.ExpectedImageDescription, set.XMP["Description"])
+	assert.Equal(t, testdata.ExpectedMake, set.Info.Make)
+	assert.Equal(t, "f/8", set.Info.FormattedAperture())
+}
+
+func TestBuildImageSetVariants(t *testing.T) {
+	set, _ := buildImageSet(testdata.Testfile, defaultOption, newMetadataLoader(), nil)
+	assert.Equal(t, []ImageVariant{
+		{Format: images.FormatJPEG, MIMEType: "image/jpeg", FileName: testdata.Collection1FileName1},
+	}, set.Variants)
+
+	option := defaultOption
+	option.Formats = []string{"webp", "jpeg"}
+	set, _ = buildImageSet(testdata.Testfile, option, newMetadataLoader(), nil)
+	assert.Equal(t, []ImageVariant{
+		{Format: images.FormatWebP, MIMEType: "image/webp", FileName: testdata.Collection1FileName1 + ".webp"},
+		{Format: images.FormatJPEG, MIMEType: "image/jpeg", FileName: testdata.Collection1FileName1},
+	}, set.Variants)
+	assert.Equal(t, images.FormatJPEG, set.FallbackVariant().Format)
+
+	// sets without variants fall back to JPEG
+	assert.Equal(t, testdata.Collection1FileName1, ImageSet{FileName: testdata.Collection1FileName1}.FallbackVariant().FileName)
+}
+
+func TestBuildThumbnails(t *testing.T) {
+	size := images.ImageSize{Width: 1440, Height: 1080}
+
+	thumbnails := buildThumbnails(size, []int{1280, 320, 640, 320, 2048})
+	assert.Equal(t, []ImageRendition{
+		{Key: "thumbnail-320", Size: images.ImageSize{Width: 320, Height: 240}},
+		{Key: "thumbnail-640", Size: images.ImageSize{Width: 640, Height: 480}},
+		{Key: "thumbnail-1280", Size: images.ImageSize{Width: 1280, Height: 960}},
+	}, thumbnails)
+
+	assert.Empty(t, buildThumbnails(size, nil))
+
+	option := defaultOption
+	option.ThumbnailWidths = []int{320, 640}
+	set, _ := buildImageSet(testdata.Testfile, option, newMetadataLoader(), nil)
+	assert.Equal(t, 2, len(set.Thumbnails))
+}
+
+func TestBuildImageSetHashFileNames(t *testing.T) {
+	option := defaultOption
+	option.HashFileNames = true
+	option.Formats = []string{"webp", "jpeg"}
+
+	set, err := buildImageSet(testdata.Testfile, option, newMetadataLoader(), nil)
+	assert.Nil(t, err)
+	assert.Regexp(t, `^2022-06-29-[0-9a-f]{10}\.jpg$`, set.OutputName)
+	assert.Equal(t, set.OutputName+".webp", set.Variants[0].FileName)
+	assert.Equal(t, set.OutputName, set.Variants[1].FileName)
+
+	// Changes with rendition settings
+	option.CompressQuality = 90
+	other, _ := buildImageSet(testdata.Testfile, option, newMetadataLoader(), nil)
+	assert.NotEqual(t, set.OutputName, other.OutputName)
+}
+
+func TestBuildURLs(t *testing.T) {
+	var meta config.SectionMetadata
+	_ = mapstructure.Decode(testdata.Collection1, &meta)
+
+	option := defaultOption
+	option.ThumbnailWidths = []int{320}
+
+	sections, _ := Build([]config.SectionMetadata{meta}, option, nil)
+	set := sections[0].ImageSets[0]
+	assert.Equal(t, "photos/slug-section-1/thumbnail/"+set.FileName, set.ThumbnailURL())
+	assert.Equal(t, "photos/slug-section-1/original/"+set.FileName, set.OriginalURL())
+	assert.Equal(t, "photos/slug-section-1/thumbnail-320/"+set.FileName, set.FallbackVariant().URLs["thumbnail-320"])
+}
+
+func TestBuildIndexCache(t *testing.T) {
+	var meta config.SectionMetadata
+	_ = mapstructure.Decode(testdata.Collection1, &meta)
+
+	index := cache.NewFolderCache(t.TempDir())
+	sections, err := Build([]config.SectionMetadata{meta}, defaultOption, index)
+	assert.Nil(t, err)
+
+	src := sections[0].ImageSets[0].SourcePath(meta.Folder)
+	record := index.IndexRecord(src)
+	assert.NotNil(t, record)
+	assert.Equal(t, sections[0].ImageSets[0].EXIF, record.Metadata.EXIF)
+
+	// Unchanged photos are not read again
+	record.ImageSize = images.ImageSize{Width: 100, Height: 50}
+	index.AddIndexRecord(src, *record)
+	sections, _ = Build([]config.SectionMetadata{meta}, defaultOption, index)
+	assert.Equal(t, images.ImageSize{Width: testdata.ThumbnailWidth, Height: testdata.ThumbnailWidth / 2}, sections[0].ImageSets[0].ThumbnailSize)
+}
+
+func TestBuildInvalidFormat(t *testing.T) {
+	var meta config.SectionMetadata
+	_ = mapstructure.Decode(testdata.Collection1, &meta)
+
+	option := defaultOption
+	option.Formats = []string{"gif"}
+
+	_, err := Build([]config.SectionMetadata{meta}, option, nil)
+	assert.NotNil(t, err)
+}
+
+func TestBuildInvalidSort(t *testing.T) {
+	var meta config.SectionMetadata
+	_ = mapstructure.Decode(testdata.Collection1, &meta)
+	meta.Sort = "date"
+
+	_, err := Build([]config.SectionMetadata{meta}, defaultOption, nil)
+	assert.NotNil(t, err)
+}
+
 func TestSectionExtractOption(t *testing.T) {
 	testCases := []struct {
 		name           string
@@ -197,6 +338,20 @@ func TestSectionExtractOption(t *testing.T) {
 				MinOriginalHeight:  1366,
 			},
 		},
+		{
+			name: "section override thumbnail widths",
+			global: config.ExtractOption{
+				ThumbnailWidth:  640,
+				ThumbnailWidths: []int{320, 640},
+			},
+			sectionMeta: config.SectionMetadata{
+				ThumbnailWidths: []int{480, 960},
+			},
+			expectedOption: config.ExtractOption{
+				ThumbnailWidth:  640,
+				ThumbnailWidths: []int{480, 960},
+			},
+		},
 		{
 			name: "zero values for section should be ignored",
 			global: config.ExtractOption{
@@ -228,6 +383,37 @@ func TestSectionExtractOption(t *testing.T) {
 			assert.Equal(t, tc.expectedOption.MinOriginalHeight, result.MinOriginalHeight, "ThumbnailHeight should match expected value")
 			assert.Equal(t, tc.expectedOption.OriginalWidth, result.OriginalWidth, "OriginalWidth should match expected value")
 			assert.Equal(t, tc.expectedOption.MinOriginalHeight, result.MinOriginalHeight, "OriginalHeight should match expected value")
+			assert.Equal(t, tc.expectedOption.ThumbnailWidths, result.ThumbnailWidths, "ThumbnailWidths should match expected value")
 		})
 	}
 }
+
+func TestBuildInvalidPageSize(t *testing.T) {
+	var meta config.SectionMetadata
+	_ = mapstructure.Decode(testdata.Collection1, &meta)
+	meta.PageSize = -1
+
+	_, err := Build([]config.SectionMetadata{meta}, defaultOption, nil)
+	assert.NotNil(t, err)
+}
+
+func TestBuildTextFile(t *testing.T) {
+	tmp := t.TempDir()
+	_ = cp.Copy(testdata.Testfile, filepath.Join(tmp, "1.jpg"))
+	_ = files.WriteDataToFile([]byte("## Essay\n\nWritten *slowly*.<script>alert(1)</script>"), filepath.Join(tmp, "essay.md"))
+
+	meta := config.SectionMetadata{
+		Title:    "Essay",
+		Text:     "An **essay**",
+		TextFile: "essay.md",
+		Slug:     "essay",
+		Folder:   tmp,
+	}
+	sections, err := Build([]config.SectionMetadata{meta}, defaultOption, nil)
+	assert.Nil(t, err)
+	assert.Equal(t, template.HTML("<p>An <strong>essay</strong></p>\n<h2>Essay</h2>\n<p>Written <em>slowly</em>.</p>\n"), sections[0].Text)
+
+	meta.TextFile = "missing.md"
+	_, err = Build([]config.SectionMetadata{meta}, defaultOption, nil)
+	assert.NotNil(t, err)
+}
@@ -0,0 +1,92 @@
+package indexer
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/pelletier/go-toml/v2"
+	"github.com/rs/zerolog/log"
+	"go.yaml.in/yaml/v3"
+)
+
+// File holding metadata of every photo in its folder, keyed by file name
+const folderMetadataFileName = "photos.toml"
+
+// Text written by the photographer for a photo, from a sidecar file or the folder metadata file
+type PhotoMetadata struct {
+	Title   string   `toml:"title" yaml:"title" json:"title"`
+	Caption string   `toml:"caption" yaml:"caption" json:"caption"`
+	Alt     string   `toml:"alt" yaml:"alt" json:"alt"`
+	Tags    []string `toml:"tags" yaml:"tags" json:"tags"`
+	Weight  int      `toml:"weight" yaml:"weight" json:"weight"`
+}
+
+// Loads photo metadata, reading each folder metadata file only once per build
+type metadataLoader struct {
+	mutex   sync.Mutex
+	folders map[string]map[string]PhotoMetadata
+}
+
+func newMetadataLoader() *metadataLoader {
+	return &metadataLoader{
+		folders: map[string]map[string]PhotoMetadata{},
+	}
+}
+
+// Metadata of the photo at `path`. A sidecar file (`photo.jpg.toml`, `.yaml`, `.yml` or `.json`)
+// takes precedence over the entry of the folder metadata file.
+func (l *metadataLoader) load(path string) PhotoMetadata {
+	for _, ext := range []string{".toml", ".yaml", ".yml", ".json"} {
+		sidecar := path + ext
+		if _, err := os.Stat(sidecar); err != nil {
+			continue
+		}
+
+		var meta PhotoMetadata
+		if err := decodeMetadataFile(sidecar, &meta); err != nil {
+			log.Warn().Msgf("Failed to parse metadata file %s (%v)", sidecar, err)
+			break
+		}
+		return meta
+	}
+
+	return l.folderMetadata(filepath.Dir(path))[filepath.Base(path)]
+}
+
+func (l *metadataLoader) folderMetadata(folder string) map[string]PhotoMetadata {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	if meta, ok := l.folders[folder]; ok {
+		return meta
+	}
+
+	meta := map[string]PhotoMetadata{}
+	path := filepath.Join(folder, folderMetadataFileName)
+	if _, err := os.Stat(path); err == nil {
+		if err := decodeMetadataFile(path, &meta); err != nil {
+			log.Warn().Msgf("Failed to parse metadata file %s (%v)", path, err)
+		}
+	}
+	l.folders[folder] = meta
+
+	return meta
+}
+
+func decodeMetadataFile(path string, v any) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	switch filepath.Ext(path) {
+	case ".yaml", ".yml":
+		return yaml.Unmarshal(data, v)
+	case ".json":
+		return json.Unmarshal(data, v)
+	default:
+		return toml.Unmarshal(data, v)
+	}
+}
@@ -0,0 +1,49 @@
+package indexer
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/waynezhang/foto/internal/files"
+)
+
+func TestLoadMetadata(t *testing.T) {
+	tmp, err := os.MkdirTemp("", "foto-test")
+	assert.Nil(t, err)
+	defer os.RemoveAll(tmp)
+
+	_ = files.WriteDataToFile([]byte(`
+["a.jpg"]
+title = "Folder title A"
+caption = "Folder caption A"
+
+["b.jpg"]
+title = "Folder title B"
+tags = ["street", "tokyo"]
+weight = 2
+`), filepath.Join(tmp, folderMetadataFileName))
+
+	_ = files.WriteDataToFile([]byte(`
+title = "Sidecar title A"
+alt = "Sidecar alt A"
+`), filepath.Join(tmp, "a.jpg.toml"))
+	_ = files.WriteDataToFile([]byte("title: Sidecar title C\ncaption: Sidecar caption C\n"), filepath.Join(tmp, "c.jpg.yaml"))
+	_ = files.WriteDataToFile([]byte(`{"title": "Sidecar title D", "weight": 1}`), filepath.Join(tmp, "d.jpg.json"))
+	_ = files.WriteDataToFile([]byte("title = "), filepath.Join(tmp, "e.jpg.toml"))
+
+	loader := newMetadataLoader()
+
+	// sidecar takes precedence over the folder metadata
+	assert.Equal(t, PhotoMetadata{Title: "Sidecar title A", Alt: "Sidecar alt A"}, loader.load(filepath.Join(tmp, "a.jpg")))
+	assert.Equal(t, PhotoMetadata{Title: "Folder title B", Tags: []string{"street", "tokyo"}, Weight: 2}, loader.load(filepath.Join(tmp, "b.jpg")))
+	assert.Equal(t, PhotoMetadata{Title: "Sidecar title C", Caption: "Sidecar caption C"}, loader.load(filepath.Join(tmp, "c.jpg")))
+	assert.Equal(t, PhotoMetadata{Title: "Sidecar title D", Weight: 1}, loader.load(filepath.Join(tmp, "d.jpg")))
+
+	// malformed sidecar falls back to the folder metadata
+	assert.Equal(t, PhotoMetadata{}, loader.load(filepath.Join(tmp, "e.jpg")))
+
+	// no metadata
+	assert.Equal(t, PhotoMetadata{}, newMetadataLoader().load(filepath.Join(tmp, "nonexisting", "f.jpg")))
+}
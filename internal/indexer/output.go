@@ -0,0 +1,50 @@
+package indexer
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/waynezhang/foto/internal/constants"
+)
+
+// Output name with a hash of the source `checksum` and the rendition settings,
+// e.g. `IMG_0001-3f2a9c1b0d.jpg`, so any change to the photo or its sizes yields a new name
+func contentHashedName(checksum string, set ImageSet) string {
+	hasher := sha256.New()
+	fmt.Fprintf(hasher, "%s|%s|%v|%v|%d", constants.CacheVersion, checksum, set.ThumbnailSize, set.OriginalSize, set.CompressQuality)
+	for _, t := range set.Thumbnails {
+		fmt.Fprintf(hasher, "|%s:%v", t.Key, t.Size)
+	}
+
+	return appendToName(set.FileName, hex.EncodeToString(hasher.Sum(nil))[:10])
+}
+
+// e.g. `IMG_0001.jpg` + `abc` → `IMG_0001-abc.jpg`
+func appendToName(name string, suffix string) string {
+	ext := filepath.Ext(name)
+	return strings.TrimSuffix(name, ext) + "-" + suffix + ext
+}
+
+// Records the URLs of every rendition on the variants of `sets`
+func assignURLs(sets []ImageSet, slug string) {
+	photosPath := strings.Trim(constants.PhotosURLPath, "/")
+	for i := range sets {
+		set := &sets[i]
+		keys := []string{"thumbnail", "original"}
+		for _, t := range set.Thumbnails {
+			keys = append(keys, t.Key)
+		}
+
+		for j := range set.Variants {
+			v := &set.Variants[j]
+			v.URLs = map[string]string{}
+			for _, key := range keys {
+				v.URLs[key] = path.Join(photosPath, slug, key, v.FileName)
+			}
+		}
+	}
+}
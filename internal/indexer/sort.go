@@ -0,0 +1,155 @@
+package indexer
+
+import (
+	"bufio"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/rs/zerolog/log"
+	"github.com/waynezhang/foto/internal/config"
+)
+
+// File listing photos of a folder in the order to be shown, one file name per line
+const orderFileName = "order.txt"
+
+const exifDateTimeLayout = "2006:01:02 15:04:05"
+
+// Sorts image sets in place. Weighted photos always come first, ordered by weight.
+// Ties and photos without the sort key fall back to file name.
+func sortImageSets(sets []ImageSet, folder string, sortBy string, ascending bool) {
+	byFileName := func(a, b ImageSet) bool {
+		// Photos of the same name in different subfolders are ordered by path
+		c := strings.Compare(a.FileName, b.FileName)
+		if c == 0 {
+			c = strings.Compare(a.Path, b.Path)
+		}
+		return directed(c, ascending) < 0
+	}
+
+	var compare func(a, b ImageSet) int
+	switch {
+	case sortBy == config.SortByModTime:
+		compare = func(a, b ImageSet) int {
+			return directed(a.ModTime.Compare(b.ModTime), ascending)
+		}
+	case sortBy == config.SortManually:
+		order := readOrderFile(filepath.Join(folder, orderFileName))
+		compare = func(a, b ImageSet) int {
+			pa, okA := order[a.FileName]
+			pb, okB := order[b.FileName]
+			return compareMissingLast(pa, okA, pb, okB, func(x, y int) int {
+				return x - y
+			})
+		}
+	case strings.HasPrefix(sortBy, config.SortByEXIFPrefix):
+		tag := strings.TrimPrefix(sortBy, config.SortByEXIFPrefix)
+		compare = func(a, b ImageSet) int {
+			return compareEXIF(a, b, tag, ascending)
+		}
+	default:
+		compare = func(a, b ImageSet) int { return 0 }
+	}
+
+	sort.SliceStable(sets, func(i, j int) bool {
+		wi, wj := sets[i].Weight, sets[j].Weight
+		if wi != wj {
+			if wi == 0 || wj == 0 {
+				return wj == 0
+			}
+			return wi < wj
+		}
+
+		if c := compare(sets[i], sets[j]); c != 0 {
+			return c < 0
+		}
+		return byFileName(sets[i], sets[j])
+	})
+}
+
+func compareEXIF(a, b ImageSet, tag string, ascending bool) int {
+	// The typed capture time respects `OffsetTimeOriginal`
+	if tag == "DateTimeOriginal" {
+		ta, tb := a.Info.CaptureTime, b.Info.CaptureTime
+		return compareMissingLast(ta, !ta.IsZero(), tb, !tb.IsZero(), func(x, y time.Time) int {
+			return directed(x.Compare(y), ascending)
+		})
+	}
+
+	va, vb := a.EXIF[tag], b.EXIF[tag]
+	return compareMissingLast(va, va != "", vb, vb != "", func(x, y string) int {
+		return directed(compareEXIFValues(x, y), ascending)
+	})
+}
+
+// Compares dates and numbers by value and everything else as text
+func compareEXIFValues(a, b string) int {
+	if ta, err := time.Parse(exifDateTimeLayout, a); err == nil {
+		if tb, err := time.Parse(exifDateTimeLayout, b); err == nil {
+			return ta.Compare(tb)
+		}
+	}
+	if fa, err := strconv.ParseFloat(a, 64); err == nil {
+		if fb, err := strconv.ParseFloat(b, 64); err == nil {
+			switch {
+			case fa < fb:
+				return -1
+			case fa > fb:
+				return 1
+			}
+			return 0
+		}
+	}
+	return strings.Compare(a, b)
+}
+
+// Missing values are ordered after present ones regardless of direction
+func compareMissingLast[T any](va T, okA bool, vb T, okB bool, compare func(x, y T) int) int {
+	switch {
+	case okA && okB:
+		return compare(va, vb)
+	case okA:
+		return -1
+	case okB:
+		return 1
+	}
+	return 0
+}
+
+func directed(c int, ascending bool) int {
+	if ascending {
+		return c
+	}
+	return -c
+}
+
+// Position of each listed file name. Blank lines and lines starting with `#` are ignored.
+func readOrderFile(path string) map[string]int {
+	order := map[string]int{}
+
+	f, err := os.Open(path)
+	if err != nil {
+		log.Warn().Msgf("Failed to read order file %s (%v)", path, err)
+		return order
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if _, ok := order[line]; !ok {
+			order[line] = len(order)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		log.Warn().Msgf("Failed to read order file %s (%v)", path, err)
+	}
+
+	return order
+}
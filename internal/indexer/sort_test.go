@@ -0,0 +1,78 @@
+package indexer
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/waynezhang/foto/internal/files"
+	"github.com/waynezhang/foto/internal/images"
+)
+
+func fileNames(sets []ImageSet) []string {
+	names := []string{}
+	for _, s := range sets {
+		names = append(names, s.FileName)
+	}
+	return names
+}
+
+func TestSortByCaptureTime(t *testing.T) {
+	base := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	sets := []ImageSet{
+		{FileName: "DSC_0001.jpg", Info: images.PhotoInfo{CaptureTime: base.Add(2 * time.Hour)}},
+		{FileName: "IMG_0001.jpg", Info: images.PhotoInfo{CaptureTime: base}},
+		{FileName: "a.jpg"},
+		{FileName: "IMG_0002.jpg", Info: images.PhotoInfo{CaptureTime: base.Add(time.Hour)}},
+	}
+
+	sortImageSets(sets, "", "exif:DateTimeOriginal", true)
+	assert.Equal(t, []string{"IMG_0001.jpg", "IMG_0002.jpg", "DSC_0001.jpg", "a.jpg"}, fileNames(sets))
+
+	sortImageSets(sets, "", "exif:DateTimeOriginal", false)
+	assert.Equal(t, []string{"DSC_0001.jpg", "IMG_0002.jpg", "IMG_0001.jpg", "a.jpg"}, fileNames(sets))
+}
+
+func TestSortByEXIFValue(t *testing.T) {
+	sets := []ImageSet{
+		{FileName: "a.jpg", EXIF: map[string]string{"ISO": "800"}},
+		{FileName: "b.jpg", EXIF: map[string]string{"ISO": "100"}},
+		{FileName: "c.jpg", EXIF: map[string]string{"ISO": "1600"}},
+		{FileName: "d.jpg", EXIF: map[string]string{"ISO": "100"}},
+	}
+
+	sortImageSets(sets, "", "exif:ISO", true)
+	assert.Equal(t, []string{"b.jpg", "d.jpg", "a.jpg", "c.jpg"}, fileNames(sets))
+}
+
+func TestSortByModTime(t *testing.T) {
+	base := time.Now()
+	sets := []ImageSet{
+		{FileName: "a.jpg", ModTime: base.Add(time.Minute)},
+		{FileName: "b.jpg", ModTime: base},
+		{FileName: "c.jpg", ModTime: base.Add(time.Minute)},
+	}
+
+	sortImageSets(sets, "", "mtime", true)
+	assert.Equal(t, []string{"b.jpg", "a.jpg", "c.jpg"}, fileNames(sets))
+}
+
+func TestSortManually(t *testing.T) {
+	tmp, _ := os.MkdirTemp("", "foto-test")
+	defer os.RemoveAll(tmp)
+
+	_ = files.WriteDataToFile([]byte("# cover first\nc.jpg\n\na.jpg\n"), filepath.Join(tmp, orderFileName))
+
+	sets := []ImageSet{
+		{FileName: "a.jpg"},
+		{FileName: "b.jpg"},
+		{FileName: "c.jpg"},
+		{FileName: "d.jpg"},
+		{FileName: "e.jpg", Weight: 1},
+	}
+
+	sortImageSets(sets, tmp, "manual", true)
+	assert.Equal(t, []string{"e.jpg", "c.jpg", "a.jpg", "b.jpg", "d.jpg"}, fileNames(sets))
+}
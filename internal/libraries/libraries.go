@@ -0,0 +1,155 @@
+package libraries
+
+import (
+	"crypto/sha512"
+	"encoding/base64"
+	"io/fs"
+	"os"
+	"path"
+	"sync"
+
+	"github.com/rs/zerolog/log"
+	staticFs "github.com/waynezhang/foto/fs"
+	"github.com/waynezhang/foto/internal/constants"
+	"github.com/waynezhang/foto/internal/files"
+)
+
+// Folder of vendored libraries, in the embedded `static` folder, in sites and in the output
+const DirectoryName = "vendor"
+
+const (
+	LozadVersion = "1.16.0"
+	GridVersion  = "1.16.0"
+)
+
+// JavaScript or CSS file of a third party library used by templates
+type Library struct {
+	// Referenced by templates, e.g. `photoswipe`
+	Key string
+	// Relative to the vendor folder
+	Path string
+	CDN  string
+}
+
+// How a template references a library
+type Reference struct {
+	URL string
+	// Subresource Integrity of the CDN file, empty for local files
+	Integrity string
+}
+
+var All = []Library{
+	{
+		Key:  "photoswipe-css",
+		Path: path.Join("photoswipe", constants.PhotoSwipeVersion, "photoswipe.css"),
+		CDN:  "https://cdnjs.cloudflare.com/ajax/libs/photoswipe/" + constants.PhotoSwipeVersion + "/photoswipe.css",
+	},
+	{
+		Key:  "photoswipe",
+		Path: path.Join("photoswipe", constants.PhotoSwipeVersion, "photoswipe.esm.min.js"),
+		CDN:  "https://cdnjs.cloudflare.com/ajax/libs/photoswipe/" + constants.PhotoSwipeVersion + "/photoswipe.esm.min.js",
+	},
+	{
+		Key:  "photoswipe-lightbox",
+		Path: path.Join("photoswipe", constants.PhotoSwipeVersion, "photoswipe-lightbox.esm.min.js"),
+		CDN:  "https://cdnjs.cloudflare.com/ajax/libs/photoswipe/" + constants.PhotoSwipeVersion + "/photoswipe-lightbox.esm.min.js",
+	},
+	{
+		Key:  "photoswipe-caption-css",
+		Path: path.Join("photoswipe-dynamic-caption-plugin", constants.PhotoSwipeCaptionPluginVersion, "photoswipe-dynamic-caption-plugin.min.css"),
+		CDN:  "https://cdnjs.cloudflare.com/ajax/libs/photoswipe-dynamic-caption-plugin/" + constants.PhotoSwipeCaptionPluginVersion + "/photoswipe-dynamic-caption-plugin.min.css",
+	},
+	{
+		Key:  "photoswipe-caption",
+		Path: path.Join("photoswipe-dynamic-caption-plugin", constants.PhotoSwipeCaptionPluginVersion, "photoswipe-dynamic-caption-plugin.esm.min.js"),
+		CDN:  "https://cdnjs.cloudflare.com/ajax/libs/photoswipe-dynamic-caption-plugin/" + constants.PhotoSwipeCaptionPluginVersion + "/photoswipe-dynamic-caption-plugin.esm.min.js",
+	},
+	{
+		Key:  "lozad",
+		Path: path.Join("lozad", LozadVersion, "lozad.min.js"),
+		CDN:  "https://cdn.jsdelivr.net/npm/lozad@" + LozadVersion + "/dist/lozad.min.js",
+	},
+	{
+		// Packaged with its dependencies, exposes the `Grid` global
+		Key:  "grid",
+		Path: path.Join("egjs-grid", GridVersion, "grid.pkgd.min.js"),
+		CDN:  "https://cdn.jsdelivr.net/npm/@egjs/grid@" + GridVersion + "/dist/grid.pkgd.min.js",
+	},
+}
+
+// Vendored libraries embedded in the binary, rooted at the vendor folder
+func Files() fs.FS {
+	sub, err := fs.Sub(staticFs.FS, path.Join("static", DirectoryName))
+	if err != nil {
+		// Only fails for invalid paths
+		panic(err)
+	}
+	return sub
+}
+
+// References of every library keyed by `Library.Key`. Local references are relative
+// to the page through `root`, CDN references carry the integrity of the vendored copy.
+func References(local bool, root string) map[string]Reference {
+	integrities := embeddedIntegrities()
+
+	refs := map[string]Reference{}
+	for _, lib := range All {
+		if local {
+			refs[lib.Key] = Reference{URL: root + path.Join(DirectoryName, lib.Path)}
+		} else {
+			refs[lib.Key] = Reference{URL: lib.CDN, Integrity: integrities[lib.Path]}
+		}
+	}
+	return refs
+}
+
+var (
+	integritiesOnce sync.Once
+	integrities     map[string]string
+)
+
+// SHA-384 of the vendored files, which are byte-identical to the CDN ones
+func embeddedIntegrities() map[string]string {
+	integritiesOnce.Do(func() {
+		integrities = map[string]string{}
+		for _, lib := range All {
+			data, err := fs.ReadFile(Files(), lib.Path)
+			if err != nil {
+				log.Debug().Msgf("Library %s is not vendored (%v)", lib.Path, err)
+				continue
+			}
+			integrities[lib.Path] = Integrity(data)
+		}
+	})
+	return integrities
+}
+
+// Subresource Integrity value of `data`
+func Integrity(data []byte) string {
+	sum := sha512.Sum384(data)
+	return "sha384-" + base64.StdEncoding.EncodeToString(sum[:])
+}
+
+// Libraries of the site, from its vendor folder when present, otherwise the embedded ones
+func Source() fs.FS {
+	if files.IsExisting(DirectoryName) {
+		return os.DirFS(DirectoryName)
+	}
+	return Files()
+}
+
+// Paths of libraries missing from `Source()`, e.g. in builds made without running `scripts/vendor`.
+// A vendor folder of the site is used as is.
+func Missing() []string {
+	if files.IsExisting(DirectoryName) {
+		return nil
+	}
+
+	missing := []string{}
+	for _, lib := range All {
+		if _, err := fs.Stat(Files(), lib.Path); err != nil {
+			missing = append(missing, lib.Path)
+		}
+	}
+	return missing
+}
@@ -0,0 +1,59 @@
+package libraries
+
+import (
+	"io/fs"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReferences(t *testing.T) {
+	local := References(true, "../")
+	assert.Equal(t, len(All), len(local))
+	assert.Equal(t, "../vendor/lozad/"+LozadVersion+"/lozad.min.js", local["lozad"].URL)
+	assert.Equal(t, "", local["lozad"].Integrity)
+
+	cdn := References(false, "../")
+	assert.Equal(t, "https://cdn.jsdelivr.net/npm/lozad@"+LozadVersion+"/dist/lozad.min.js", cdn["lozad"].URL)
+}
+
+func TestIntegrity(t *testing.T) {
+	// echo -n "alert('Hello, world.');" | openssl dgst -sha384 -binary | openssl base64 -A
+	assert.Equal(t, "sha384-H8BRh8j48O9oYatfu5AZzq6A9RINhZO5H16dQZngK7T62em8MUt1FLm52t+eX6xO", Integrity([]byte("alert('Hello, world.');")))
+}
+
+func TestMissing(t *testing.T) {
+	t.Chdir(t.TempDir())
+	for _, path := range Missing() {
+		_, err := fs.Stat(Files(), path)
+		assert.NotNil(t, err)
+		assert.Empty(t, References(false, "")[keyOf(path)].Integrity)
+	}
+
+	// The vendor folder of the site is used as is
+	_ = os.MkdirAll(DirectoryName, 0755)
+	assert.Empty(t, Missing())
+}
+
+func TestAllVendoredInCI(t *testing.T) {
+	// CI runs scripts/vendor like release builds do
+	if os.Getenv("CI") == "" {
+		t.Skip("not in CI")
+	}
+
+	t.Chdir(t.TempDir())
+	assert.Empty(t, Missing())
+	for _, lib := range All {
+		assert.NotEmpty(t, References(false, "")[lib.Key].Integrity, lib.Key)
+	}
+}
+
+func keyOf(path string) string {
+	for _, lib := range All {
+		if lib.Path == path {
+			return lib.Key
+		}
+	}
+	return ""
+}
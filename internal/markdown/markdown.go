@@ -0,0 +1,29 @@
+package markdown
+
+import (
+	"bytes"
+	"html/template"
+
+	"github.com/microcosm-cc/bluemonday"
+	"github.com/yuin/goldmark"
+	"github.com/yuin/goldmark/extension"
+	"github.com/yuin/goldmark/renderer/html"
+)
+
+var (
+	// Raw HTML is kept and sanitized with the rest of the output
+	converter = goldmark.New(
+		goldmark.WithExtensions(extension.GFM),
+		goldmark.WithRendererOptions(html.WithUnsafe()),
+	)
+	policy = bluemonday.UGCPolicy()
+)
+
+// Markdown rendered to HTML, without elements and attributes unsafe for the page such as scripts
+func Render(source string) (template.HTML, error) {
+	buf := new(bytes.Buffer)
+	if err := converter.Convert([]byte(source), buf); err != nil {
+		return "", err
+	}
+	return template.HTML(policy.SanitizeBytes(buf.Bytes())), nil
+}
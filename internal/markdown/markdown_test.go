@@ -0,0 +1,27 @@
+package markdown
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRender(t *testing.T) {
+	html, err := Render("Photos from **Kyoto**, see [map](https://example.com).")
+	assert.Nil(t, err)
+	assert.Equal(t, "<p>Photos from <strong>Kyoto</strong>, see <a href=\"https://example.com\" rel=\"nofollow\">map</a>.</p>\n", string(html))
+}
+
+func TestRenderSanitized(t *testing.T) {
+	html, err := Render("[link](javascript:alert(1)) <script>alert(1)</script> <img src=\"a.jpg\" onerror=\"alert(1)\">")
+	assert.Nil(t, err)
+	assert.NotContains(t, string(html), "javascript:")
+	assert.NotContains(t, string(html), "<script>")
+	assert.NotContains(t, string(html), "onerror")
+}
+
+func TestRenderRawHTML(t *testing.T) {
+	html, err := Render(`<a href="https://example.com" target="_blank">link</a>`)
+	assert.Nil(t, err)
+	assert.Contains(t, string(html), `<a href="https://example.com"`)
+}
@@ -0,0 +1,261 @@
+package pages
+
+import (
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/waynezhang/foto/internal/images"
+	"github.com/waynezhang/foto/internal/indexer"
+	"github.com/waynezhang/foto/internal/markdown"
+)
+
+// Layouts of dates in strings accepted by `formatDate`, e.g. EXIF `DateTimeOriginal`
+var dateLayouts = []string{
+	time.RFC3339,
+	"2006:01:02 15:04:05",
+	"2006-01-02 15:04:05",
+	"2006-01-02",
+}
+
+// Helpers available in every template. URLs built by `urlFor` are relative to `root`.
+//
+//	formatDate "2006-01-02" .Info.CaptureTime    date in Go layout, from a time or a date string
+//	markdown .Config.site.description            Markdown rendered to sanitized HTML
+//	exposure .EXIF.ExposureTime                  `1/250s` from seconds or a fraction
+//	aspectRatio .OriginalSize                    width / height of a size, or of a width and a height
+//	urlFor .                                     URL of a section page, a photo rendition or a site path
+//	json .Config.layout                          value as JSON, e.g. for scripts
+//	default "Untitled" .Title                    the value, or the default when the value is empty
+//	slice .Caption 0 100                         like the builtin `slice`, with indices clamped to the length
+func Funcs(root string) template.FuncMap {
+	return template.FuncMap{
+		"formatDate":  formatDate,
+		"markdown":    renderMarkdown,
+		"exposure":    exposure,
+		"aspectRatio": aspectRatio,
+		"urlFor": func(target any, rendition ...string) (string, error) {
+			return urlFor(root, target, rendition...)
+		},
+		"json":    toJSON,
+		"default": defaultValue,
+		"slice":   slice,
+	}
+}
+
+func formatDate(layout string, value any) (string, error) {
+	switch v := value.(type) {
+	case nil:
+		return "", nil
+	case time.Time:
+		if v.IsZero() {
+			return "", nil
+		}
+		return v.Format(layout), nil
+	case *time.Time:
+		if v == nil {
+			return "", nil
+		}
+		return formatDate(layout, *v)
+	case string:
+		if v == "" {
+			return "", nil
+		}
+		for _, l := range dateLayouts {
+			if t, err := time.Parse(l, v); err == nil {
+				return t.Format(layout), nil
+			}
+		}
+		return "", fmt.Errorf("formatDate: failed to parse date %q", v)
+	}
+	return "", fmt.Errorf("formatDate: unsupported value %v", value)
+}
+
+func renderMarkdown(value any) (template.HTML, error) {
+	return markdown.Render(toString(value))
+}
+
+// Exposure time from seconds, e.g. `0.004`, or a fraction, e.g. `1/250` in EXIF
+func exposure(value any) (string, error) {
+	switch v := value.(type) {
+	case nil:
+		return "", nil
+	case float64:
+		return images.FormatExposureTime(v), nil
+	case float32:
+		return images.FormatExposureTime(float64(v)), nil
+	case int:
+		return images.FormatExposureTime(float64(v)), nil
+	case string:
+		v = strings.TrimSpace(strings.TrimSuffix(v, "s"))
+		if v == "" {
+			return "", nil
+		}
+		if num, den, ok := strings.Cut(v, "/"); ok {
+			n, err1 := strconv.ParseFloat(num, 64)
+			d, err2 := strconv.ParseFloat(den, 64)
+			if err1 != nil || err2 != nil || d == 0 {
+				return "", fmt.Errorf("exposure: invalid fraction %q", v)
+			}
+			return images.FormatExposureTime(n / d), nil
+		}
+		seconds, err := strconv.ParseFloat(v, 64)
+		if err != nil {
+			return "", fmt.Errorf("exposure: invalid exposure time %q", v)
+		}
+		return images.FormatExposureTime(seconds), nil
+	}
+	return "", fmt.Errorf("exposure: unsupported value %v", value)
+}
+
+// Width divided by height of an `images.ImageSize` or of a width and a height, 0 without a height
+func aspectRatio(values ...any) (float64, error) {
+	var width, height float64
+	switch {
+	case len(values) == 1:
+		size, ok := values[0].(images.ImageSize)
+		if !ok {
+			return 0, fmt.Errorf("aspectRatio: unsupported value %v", values[0])
+		}
+		width, height = float64(size.Width), float64(size.Height)
+	case len(values) == 2:
+		w, ok1 := toFloat(values[0])
+		h, ok2 := toFloat(values[1])
+		if !ok1 || !ok2 {
+			return 0, fmt.Errorf("aspectRatio: unsupported values %v", values)
+		}
+		width, height = w, h
+	default:
+		return 0, fmt.Errorf("aspectRatio: expected a size or a width and a height")
+	}
+
+	if height == 0 {
+		return 0, nil
+	}
+	return width / height, nil
+}
+
+// URL of a section page, of a rendition of a photo or variant (`original` by default),
+// or of a path relative to the site root
+func urlFor(root string, target any, rendition ...string) (string, error) {
+	key := "original"
+	if len(rendition) > 0 {
+		key = rendition[0]
+	}
+
+	var urls map[string]string
+	switch v := target.(type) {
+	case string:
+		return root + strings.TrimPrefix(v, "/"), nil
+	case indexer.Section:
+		return root + v.Slug + "/", nil
+	case *indexer.Section:
+		return root + v.Slug + "/", nil
+	case indexer.ImageSet:
+		urls = v.FallbackVariant().URLs
+	case *indexer.ImageSet:
+		urls = v.FallbackVariant().URLs
+	case indexer.ImageVariant:
+		urls = v.URLs
+	default:
+		return "", fmt.Errorf("urlFor: unsupported value %v", target)
+	}
+
+	url, ok := urls[key]
+	if !ok {
+		return "", fmt.Errorf("urlFor: rendition %s not found", key)
+	}
+	return root + url, nil
+}
+
+func toJSON(value any) (template.JS, error) {
+	data, err := json.Marshal(value)
+	if err != nil {
+		return "", err
+	}
+	return template.JS(data), nil
+}
+
+// `value` unless it is missing, zero or empty
+func defaultValue(def any, value ...any) any {
+	if len(value) == 0 || isEmpty(value[0]) {
+		return def
+	}
+	return value[0]
+}
+
+// Same as the builtin `slice` but indices beyond the length are clamped, so text and lists
+// can be truncated safely. Strings are sliced by characters.
+func slice(item any, indices ...int) (any, error) {
+	if len(indices) > 2 {
+		return nil, fmt.Errorf("slice: too many indices")
+	}
+	for _, i := range indices {
+		if i < 0 {
+			return nil, fmt.Errorf("slice: negative index %d", i)
+		}
+	}
+
+	v := reflect.ValueOf(item)
+	switch v.Kind() {
+	case reflect.String:
+		runes := []rune(v.String())
+		start, end := sliceBounds(len(runes), indices)
+		return string(runes[start:end]), nil
+	case reflect.Slice, reflect.Array:
+		start, end := sliceBounds(v.Len(), indices)
+		return v.Slice(start, end).Interface(), nil
+	}
+	return nil, fmt.Errorf("slice: unsupported value %v", item)
+}
+
+func sliceBounds(length int, indices []int) (int, int) {
+	start, end := 0, length
+	if len(indices) > 0 {
+		start = min(indices[0], length)
+	}
+	if len(indices) > 1 {
+		end = max(min(indices[1], length), start)
+	}
+	return start, end
+}
+
+func isEmpty(value any) bool {
+	if value == nil {
+		return true
+	}
+	v := reflect.ValueOf(value)
+	switch v.Kind() {
+	case reflect.String, reflect.Slice, reflect.Map, reflect.Array:
+		return v.Len() == 0
+	}
+	return v.IsZero()
+}
+
+func toString(value any) string {
+	switch v := value.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	case template.HTML:
+		return string(v)
+	}
+	return fmt.Sprint(value)
+}
+
+func toFloat(value any) (float64, bool) {
+	switch v := value.(type) {
+	case int:
+		return float64(v), true
+	case float64:
+		return v, true
+	case float32:
+		return float64(v), true
+	}
+	return 0, false
+}
@@ -0,0 +1,186 @@
+package pages
+
+import (
+	"bytes"
+	"html/template"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/waynezhang/foto/internal/files"
+	"github.com/waynezhang/foto/internal/images"
+	"github.com/waynezhang/foto/internal/indexer"
+)
+
+func TestFormatDate(t *testing.T) {
+	date := time.Date(2024, 3, 15, 10, 30, 0, 0, time.UTC)
+
+	for _, value := range []any{date, &date, "2024-03-15T10:30:00Z", "2024:03:15 10:30:00", "2024-03-15 10:30:00"} {
+		s, err := formatDate("2006-01-02 15:04", value)
+		assert.Nil(t, err)
+		assert.Equal(t, "2024-03-15 10:30", s)
+	}
+
+	for _, value := range []any{nil, time.Time{}, (*time.Time)(nil), ""} {
+		s, err := formatDate("2006-01-02", value)
+		assert.Nil(t, err)
+		assert.Empty(t, s)
+	}
+
+	_, err := formatDate("2006-01-02", "yesterday")
+	assert.NotNil(t, err)
+	_, err = formatDate("2006-01-02", 42)
+	assert.NotNil(t, err)
+}
+
+func TestRenderMarkdown(t *testing.T) {
+	html, err := renderMarkdown(template.HTML("**Kyoto**<script>alert(1)</script>"))
+	assert.Nil(t, err)
+	assert.Equal(t, template.HTML("<p><strong>Kyoto</strong></p>\n"), html)
+
+	html, err = renderMarkdown(nil)
+	assert.Nil(t, err)
+	assert.Empty(t, html)
+}
+
+func TestExposure(t *testing.T) {
+	for value, expected := range map[any]string{
+		0.004:      "1/250s",
+		float32(2): "2s",
+		1:          "1s",
+		"1/250":    "1/250s",
+		"0.004":    "1/250s",
+		"2.5s":     "2.5s",
+		"":         "",
+	} {
+		s, err := exposure(value)
+		assert.Nil(t, err)
+		assert.Equal(t, expected, s, value)
+	}
+
+	for _, value := range []any{"1/0", "fast", true} {
+		_, err := exposure(value)
+		assert.NotNil(t, err, value)
+	}
+}
+
+func TestAspectRatio(t *testing.T) {
+	ratio, err := aspectRatio(images.ImageSize{Width: 1600, Height: 900})
+	assert.Nil(t, err)
+	assert.InDelta(t, 16.0/9.0, ratio, 0.0001)
+
+	ratio, err = aspectRatio(300, 200.0)
+	assert.Nil(t, err)
+	assert.Equal(t, 1.5, ratio)
+
+	ratio, err = aspectRatio(images.ImageSize{Width: 100})
+	assert.Nil(t, err)
+	assert.Equal(t, 0.0, ratio)
+
+	_, err = aspectRatio("wide")
+	assert.NotNil(t, err)
+	_, err = aspectRatio()
+	assert.NotNil(t, err)
+}
+
+func TestURLFor(t *testing.T) {
+	variant := indexer.ImageVariant{
+		FileName: "1.jpg",
+		URLs: map[string]string{
+			"thumbnail": "photos/section-1/thumbnail/1.jpg",
+			"original":  "photos/section-1/original/1.jpg",
+		},
+	}
+	set := indexer.ImageSet{FileName: "1.jpg", Variants: []indexer.ImageVariant{variant}}
+	section := indexer.Section{Slug: "section-1"}
+
+	for _, c := range []struct {
+		target    any
+		rendition []string
+		expected  string
+	}{
+		{section, nil, "../section-1/"},
+		{&section, nil, "../section-1/"},
+		{set, nil, "../photos/section-1/original/1.jpg"},
+		{&set, []string{"thumbnail"}, "../photos/section-1/thumbnail/1.jpg"},
+		{variant, []string{"thumbnail"}, "../photos/section-1/thumbnail/1.jpg"},
+		{"/assets/style.css", nil, "../assets/style.css"},
+	} {
+		url, err := urlFor("../", c.target, c.rendition...)
+		assert.Nil(t, err)
+		assert.Equal(t, c.expected, url)
+	}
+
+	_, err := urlFor("", set, "thumbnail-320")
+	assert.NotNil(t, err)
+	_, err = urlFor("", 42)
+	assert.NotNil(t, err)
+}
+
+func TestJSON(t *testing.T) {
+	js, err := toJSON(map[string]any{"gap": 8, "title": "</script>"})
+	assert.Nil(t, err)
+	// Safe to embed in scripts
+	assert.Equal(t, template.JS(`{"gap":8,"title":"\u003c/script\u003e"}`), js)
+
+	_, err = toJSON(func() {})
+	assert.NotNil(t, err)
+}
+
+func TestDefault(t *testing.T) {
+	assert.Equal(t, "Untitled", defaultValue("Untitled"))
+	assert.Equal(t, "Untitled", defaultValue("Untitled", nil))
+	assert.Equal(t, "Untitled", defaultValue("Untitled", ""))
+	assert.Equal(t, 4, defaultValue(4, 0))
+	assert.Equal(t, []string{"a"}, defaultValue([]string{"a"}, []string{}))
+	assert.Equal(t, "Title", defaultValue("Untitled", "Title"))
+	assert.Equal(t, 3, defaultValue(4, 3))
+}
+
+func TestSlice(t *testing.T) {
+	s, err := slice("日本語テキスト", 0, 3)
+	assert.Nil(t, err)
+	assert.Equal(t, "日本語", s)
+
+	s, err = slice("short", 0, 100)
+	assert.Nil(t, err)
+	assert.Equal(t, "short", s)
+
+	s, err = slice(template.HTML("<b>bold</b>"), 0, 3)
+	assert.Nil(t, err)
+	assert.Equal(t, "<b>", s)
+
+	s, err = slice([]int{1, 2, 3, 4}, 1)
+	assert.Nil(t, err)
+	assert.Equal(t, []int{2, 3, 4}, s)
+
+	s, err = slice([]int{1, 2, 3, 4}, 3, 1)
+	assert.Nil(t, err)
+	assert.Equal(t, []int{}, s)
+
+	s, err = slice([]int{1, 2, 3, 4})
+	assert.Nil(t, err)
+	assert.Equal(t, []int{1, 2, 3, 4}, s)
+
+	_, err = slice([]int{1}, -1)
+	assert.NotNil(t, err)
+	_, err = slice([]int{1}, 0, 1, 2)
+	assert.NotNil(t, err)
+	_, err = slice(42, 0)
+	assert.NotNil(t, err)
+}
+
+func TestRenderFuncs(t *testing.T) {
+	tmp, _ := os.MkdirTemp("", "foto-test")
+	defer os.RemoveAll(tmp)
+
+	templatePath := filepath.Join(tmp, "section.html")
+	_ = files.WriteDataToFile([]byte(`{{ urlFor .Section }}|{{ slice .Config.site.title 0 2 }}|{{ default "none" .Config.site.missing }}`), templatePath)
+
+	buf := new(bytes.Buffer)
+	err := Render(buf, testConfig{}, testSections, Page{TemplatePath: templatePath, Root: "../", Section: &testSections[0]})
+	assert.Nil(t, err)
+	assert.Equal(t, "../section-1/|Te|none", buf.String())
+}
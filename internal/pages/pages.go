@@ -0,0 +1,161 @@
+package pages
+
+import (
+	"io"
+	"path"
+	"strconv"
+	"strings"
+
+	"github.com/waynezhang/foto/internal/config"
+	"github.com/waynezhang/foto/internal/indexer"
+	"github.com/waynezhang/foto/internal/libraries"
+	"github.com/waynezhang/foto/internal/theme"
+)
+
+// One HTML page of the site
+type Page struct {
+	TemplatePath string
+	// Output file relative to the site root, e.g. `index.html` or `<slug>/index.html`
+	FilePath string
+	// Path served by preview, e.g. `/` or `/<slug>/`
+	URLPath string
+	// Relative path from the page to the site root, e.g. `../`
+	Root string
+	// Section of a section page, nil for the index page.
+	// Only holds the photos of the page when the section is paginated.
+	Section    *indexer.Section
+	Pagination *Pagination
+}
+
+// Position of a page within a paginated section
+type Pagination struct {
+	// Starts from 1
+	Number int
+	Count  int
+	// Relative URLs of the previous and next pages, empty on the first and last page
+	PrevURL string
+	NextURL string
+}
+
+// Data handed to every template
+type Data struct {
+	Config     map[string]any
+	Sections   []indexer.Section
+	Section    *indexer.Section
+	Root       string
+	Pagination *Pagination
+	// JavaScript and CSS libraries keyed by `libraries.Library.Key`
+	Libraries map[string]libraries.Reference
+}
+
+// Pages of the site. A single page with every section by default, or an index page
+// plus one page per section and sub-album in multi-page mode.
+func Build(option config.PageOption, sections []indexer.Section) []Page {
+	// Sections are not paginated on a single page
+	if !option.MultiPage {
+		return []Page{{
+			TemplatePath: option.Template,
+			FilePath:     "index.html",
+			URLPath:      "/",
+		}}
+	}
+
+	pages := []Page{{
+		TemplatePath: option.IndexTemplate,
+		FilePath:     "index.html",
+		URLPath:      "/",
+	}}
+	albums := indexer.Flatten(sections)
+	for i := range albums {
+		pages = append(pages, sectionPages(option, &albums[i])...)
+	}
+	return pages
+}
+
+// `/<slug>/` for the first page and `/<slug>/page/<n>/` for the others
+func sectionPages(option config.PageOption, s *indexer.Section) []Page {
+	if s.PageSize <= 0 || len(s.ImageSets) <= s.PageSize {
+		return []Page{{
+			TemplatePath: option.SectionTemplate,
+			FilePath:     path.Join(s.Slug, "index.html"),
+			URLPath:      "/" + s.Slug + "/",
+			Root:         "../",
+			Section:      s,
+		}}
+	}
+
+	count := (len(s.ImageSets) + s.PageSize - 1) / s.PageSize
+	dir := func(number int) string {
+		if number == 1 {
+			return s.Slug
+		}
+		return path.Join(s.Slug, "page", strconv.Itoa(number))
+	}
+
+	pages := []Page{}
+	for number := 1; number <= count; number++ {
+		root := strings.Repeat("../", strings.Count(dir(number), "/")+1)
+
+		section := *s
+		end := min(number*s.PageSize, len(s.ImageSets))
+		section.ImageSets = s.ImageSets[(number-1)*s.PageSize : end]
+
+		pagination := &Pagination{Number: number, Count: count}
+		if number > 1 {
+			pagination.PrevURL = root + dir(number-1) + "/"
+		}
+		if number < count {
+			pagination.NextURL = root + dir(number+1) + "/"
+		}
+
+		pages = append(pages, Page{
+			TemplatePath: option.SectionTemplate,
+			FilePath:     path.Join(dir(number), "index.html"),
+			URLPath:      "/" + dir(number) + "/",
+			Root:         root,
+			Section:      &section,
+			Pagination:   pagination,
+		})
+	}
+	return pages
+}
+
+// Page served at `urlPath`, accepting `/<slug>`, `/<slug>/` and `/<slug>/index.html`
+func Find(pages []Page, urlPath string) *Page {
+	urlPath = strings.TrimSuffix(urlPath, "index.html")
+	if !strings.HasSuffix(urlPath, "/") {
+		urlPath += "/"
+	}
+	for i := range pages {
+		if pages[i].URLPath == urlPath {
+			return &pages[i]
+		}
+	}
+	return nil
+}
+
+// Same data for a partial rendering `section`, e.g. `{{ template "section" ($.WithSection .) }}`
+func (d Data) WithSection(section indexer.Section) Data {
+	d.Section = &section
+	return d
+}
+
+func Render(w io.Writer, cfg config.Config, sections []indexer.Section, page Page) error {
+	t, err := theme.Load(cfg.GetPageOption().Theme)
+	if err != nil {
+		return err
+	}
+	tmpl, err := t.Template(page.TemplatePath, Funcs(page.Root))
+	if err != nil {
+		return err
+	}
+
+	return tmpl.Execute(w, Data{
+		Config:     cfg.AllSettings(),
+		Sections:   sections,
+		Section:    page.Section,
+		Root:       page.Root,
+		Pagination: page.Pagination,
+		Libraries:  libraries.References(cfg.GetLibraryOption().Local, page.Root),
+	})
+}
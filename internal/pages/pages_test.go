@@ -0,0 +1,199 @@
+package pages
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/waynezhang/foto/internal/config"
+	"github.com/waynezhang/foto/internal/constants"
+	"github.com/waynezhang/foto/internal/files"
+	"github.com/waynezhang/foto/internal/indexer"
+	"github.com/waynezhang/foto/internal/libraries"
+)
+
+type testConfig struct {
+	config.Config
+	theme string
+}
+
+func (cfg testConfig) GetPageOption() config.PageOption {
+	return config.PageOption{Theme: cfg.theme}
+}
+
+func (testConfig) GetLibraryOption() config.LibraryOption {
+	return config.LibraryOption{Local: true}
+}
+
+func (testConfig) AllSettings() map[string]any {
+	return map[string]any{"site": map[string]any{"title": "Test"}}
+}
+
+var testSections = []indexer.Section{
+	{Title: "Section 1", Slug: "section-1"},
+	{Title: "Section 2", Slug: "section-2"},
+}
+
+func TestBuildSinglePage(t *testing.T) {
+	pages := Build(config.PageOption{Template: constants.TemplateFilePath}, testSections)
+	assert.Equal(t, []Page{{
+		TemplatePath: constants.TemplateFilePath,
+		FilePath:     "index.html",
+		URLPath:      "/",
+	}}, pages)
+}
+
+func TestBuildMultiPage(t *testing.T) {
+	option := config.PageOption{
+		MultiPage:       true,
+		IndexTemplate:   "index.html",
+		SectionTemplate: "section.html",
+	}
+	pages := Build(option, testSections)
+	assert.Equal(t, 3, len(pages))
+
+	assert.Equal(t, "index.html", pages[0].TemplatePath)
+	assert.Equal(t, "index.html", pages[0].FilePath)
+	assert.Nil(t, pages[0].Section)
+
+	assert.Equal(t, "section.html", pages[2].TemplatePath)
+	assert.Equal(t, "section-2/index.html", pages[2].FilePath)
+	assert.Equal(t, "/section-2/", pages[2].URLPath)
+	assert.Equal(t, "../", pages[2].Root)
+	assert.Equal(t, "Section 2", pages[2].Section.Title)
+}
+
+func TestBuildSubAlbums(t *testing.T) {
+	sections := []indexer.Section{{
+		Slug:     "parent",
+		Children: []indexer.Section{{Slug: "parent-child"}},
+	}}
+	pages := Build(config.PageOption{MultiPage: true}, sections)
+	assert.Equal(t, 3, len(pages))
+	assert.Equal(t, "parent-child/index.html", pages[2].FilePath)
+	assert.Equal(t, "../", pages[2].Root)
+}
+
+func TestFind(t *testing.T) {
+	pages := Build(config.PageOption{MultiPage: true}, testSections)
+
+	assert.Equal(t, "/", Find(pages, "/").URLPath)
+	assert.Equal(t, "/", Find(pages, "/index.html").URLPath)
+	assert.Equal(t, "/section-1/", Find(pages, "/section-1").URLPath)
+	assert.Equal(t, "/section-1/", Find(pages, "/section-1/").URLPath)
+	assert.Equal(t, "/section-1/", Find(pages, "/section-1/index.html").URLPath)
+	assert.Nil(t, Find(pages, "/not-found/"))
+}
+
+func TestRender(t *testing.T) {
+	tmp, _ := os.MkdirTemp("", "foto-test")
+	defer os.RemoveAll(tmp)
+
+	templatePath := filepath.Join(tmp, "section.html")
+	_ = files.WriteDataToFile([]byte(`{{ .Config.site.title }}|{{ .Section.Title }}|{{ len .Sections }}|{{ .Root }}|{{ .Libraries.lozad.URL }}`), templatePath)
+
+	pages := Build(config.PageOption{MultiPage: true, SectionTemplate: templatePath}, testSections)
+
+	buf := new(bytes.Buffer)
+	err := Render(buf, testConfig{}, testSections, pages[1])
+	assert.Nil(t, err)
+	assert.Equal(t, "Test|Section 1|2|../|../vendor/lozad/"+libraries.LozadVersion+"/lozad.min.js", buf.String())
+}
+
+func TestRenderPartials(t *testing.T) {
+	tmp, _ := os.MkdirTemp("", "foto-test")
+	defer os.RemoveAll(tmp)
+
+	templatePath := filepath.Join(tmp, "template.html")
+	_ = files.WriteDataToFile([]byte(`{{ template "layout" . }}{{ define "main" }}{{ template "title" . }}{{ end }}`), templatePath)
+	_ = files.WriteDataToFile([]byte(`{{ define "layout" }}[{{ block "main" . }}{{ end }}]{{ end }}`), filepath.Join(tmp, "layouts", "layout.html"))
+	_ = files.WriteDataToFile([]byte(`{{ define "title" }}{{ .Config.site.title }}{{ end }}`), filepath.Join(tmp, "partials", "title.html"))
+
+	buf := new(bytes.Buffer)
+	err := Render(buf, testConfig{}, testSections, Page{TemplatePath: templatePath})
+	assert.Nil(t, err)
+	assert.Equal(t, "[Test]", buf.String())
+}
+
+func TestRenderBuiltInTheme(t *testing.T) {
+	sections := []indexer.Section{{Title: "Section 1", Slug: "section-1", ImageSets: []indexer.ImageSet{{FileName: "1.jpg"}}}}
+	cfg := testConfig{theme: "default"}
+
+	for _, page := range Build(config.PageOption{MultiPage: true, IndexTemplate: "index.html", SectionTemplate: "section.html"}, sections) {
+		buf := new(bytes.Buffer)
+		err := Render(buf, cfg, sections, page)
+		assert.Nil(t, err)
+		assert.Contains(t, buf.String(), "<title>")
+		assert.Contains(t, buf.String(), page.Root+"theme/style.css")
+		assert.Contains(t, buf.String(), "Section 1")
+	}
+
+	buf := new(bytes.Buffer)
+	err := Render(buf, cfg, sections, Page{TemplatePath: "template.html"})
+	assert.Nil(t, err)
+	assert.Contains(t, buf.String(), "photos/section-1/thumbnail/1.jpg")
+}
+
+func TestRenderInvalidTemplate(t *testing.T) {
+	page := Page{TemplatePath: "not-existing.html"}
+	err := Render(new(bytes.Buffer), testConfig{}, testSections, page)
+	assert.NotNil(t, err)
+}
+
+func TestBuildPaginated(t *testing.T) {
+	section := indexer.Section{Title: "Section 1", Slug: "section-1", PageSize: 2}
+	for _, name := range []string{"1.jpg", "2.jpg", "3.jpg", "4.jpg", "5.jpg"} {
+		section.ImageSets = append(section.ImageSets, indexer.ImageSet{FileName: name})
+	}
+
+	pages := Build(config.PageOption{MultiPage: true}, []indexer.Section{section})
+	assert.Equal(t, 4, len(pages))
+
+	first := pages[1]
+	assert.Equal(t, "section-1/index.html", first.FilePath)
+	assert.Equal(t, "/section-1/", first.URLPath)
+	assert.Equal(t, "../", first.Root)
+	assert.Equal(t, 2, len(first.Section.ImageSets))
+	assert.Equal(t, Pagination{Number: 1, Count: 3, NextURL: "../section-1/page/2/"}, *first.Pagination)
+
+	second := pages[2]
+	assert.Equal(t, "section-1/page/2/index.html", second.FilePath)
+	assert.Equal(t, "/section-1/page/2/", second.URLPath)
+	assert.Equal(t, "../../../", second.Root)
+	assert.Equal(t, "3.jpg", second.Section.ImageSets[0].FileName)
+	assert.Equal(t, Pagination{
+		Number:  2,
+		Count:   3,
+		PrevURL: "../../../section-1/",
+		NextURL: "../../../section-1/page/3/",
+	}, *second.Pagination)
+
+	last := pages[3]
+	assert.Equal(t, 1, len(last.Section.ImageSets))
+	assert.Equal(t, "", last.Pagination.NextURL)
+
+	// The whole section is kept for the index page
+	assert.Equal(t, 5, len(section.ImageSets))
+	assert.Equal(t, last, *Find(pages, "/section-1/page/3"))
+}
+
+func TestBuildNotPaginated(t *testing.T) {
+	section := indexer.Section{Slug: "section-1", PageSize: 10, ImageSets: []indexer.ImageSet{{}, {}}}
+
+	pages := Build(config.PageOption{MultiPage: true}, []indexer.Section{section})
+	assert.Equal(t, 2, len(pages))
+	assert.Nil(t, pages[1].Pagination)
+
+	pages = Build(config.PageOption{}, []indexer.Section{{Slug: "section-1", PageSize: 1, ImageSets: []indexer.ImageSet{{}, {}}}})
+	assert.Equal(t, 1, len(pages))
+}
+
+func TestWithSection(t *testing.T) {
+	data := Data{Root: "../"}
+	with := data.WithSection(testSections[1])
+	assert.Equal(t, "section-2", with.Section.Slug)
+	assert.Equal(t, "../", with.Root)
+	assert.Nil(t, data.Section)
+}
@@ -151,6 +151,7 @@ var (
 	ExpectedExposureTime     = "1/340"
 	ExpectedISO              = "100"
 	ExpectedApertureValue    = "8"
+	ExpectedXMPLens          = "50.0 mm f/3.5"
 
 	PngMetadataTestFile         = "../../testdata/exif/test.png"
 	PngExpectedImageDescription = "A png new description"
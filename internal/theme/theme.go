@@ -0,0 +1,135 @@
+package theme
+
+import (
+	"fmt"
+	"html/template"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+
+	"github.com/pelletier/go-toml/v2"
+	staticFs "github.com/waynezhang/foto/fs"
+)
+
+const (
+	// Folder of built-in themes in the embedded `static` folder
+	builtInDirectory = "themes"
+	// Default config values of a theme
+	configFileName = "theme.toml"
+	// Files copied to the output root on export
+	staticDirectory = "static"
+)
+
+// Folders of templates parsed together with each page template
+var sharedTemplateDirectories = []string{"layouts", "partials"}
+
+// Templates, static assets and default config values of a site.
+// A theme is a folder holding page templates (e.g. `template.html`, `index.html` and
+// `section.html`), `layouts/*.html` and `partials/*.html` shared by every page,
+// a `static` folder and a `theme.toml`.
+type Theme struct {
+	Name string
+	// Nil when no theme is configured and the templates of the site are used
+	FS fs.FS
+	// Folder of the theme on disk, empty for built-in themes
+	Dir string
+}
+
+// Theme named `name`, either a folder or a built-in theme. An empty name is the site
+// itself, whose page templates are files and whose shared templates are next to them.
+func Load(name string) (*Theme, error) {
+	if name == "" {
+		return &Theme{}, nil
+	}
+
+	if info, err := os.Stat(name); err == nil && info.IsDir() {
+		return &Theme{Name: name, FS: os.DirFS(name), Dir: name}, nil
+	}
+
+	builtIn := path.Join("static", builtInDirectory, name)
+	if info, err := fs.Stat(staticFs.FS, builtIn); err == nil && info.IsDir() {
+		sub, err := fs.Sub(staticFs.FS, builtIn)
+		if err != nil {
+			return nil, err
+		}
+		return &Theme{Name: name, FS: sub}, nil
+	}
+
+	return nil, fmt.Errorf("theme %s is neither a folder nor a built-in theme", name)
+}
+
+// Page template at `name` parsed together with the shared templates, with `funcs` available.
+// The page is parsed last so its definitions override the blocks of layouts and partials.
+func (t *Theme) Template(name string, funcs template.FuncMap) (*template.Template, error) {
+	tmpl := template.New(path.Base(filepath.ToSlash(name))).Funcs(funcs)
+	for _, dir := range sharedTemplateDirectories {
+		matches, err := t.glob(t.sharedPattern(name, dir))
+		if err != nil {
+			return nil, err
+		}
+		if len(matches) == 0 {
+			continue
+		}
+		if tmpl, err = t.parse(tmpl, matches...); err != nil {
+			return nil, err
+		}
+	}
+	return t.parse(tmpl, name)
+}
+
+func (t *Theme) sharedPattern(name string, dir string) string {
+	if t.FS == nil {
+		return filepath.Join(filepath.Dir(name), dir, "*.html")
+	}
+	return path.Join(dir, "*.html")
+}
+
+func (t *Theme) glob(pattern string) ([]string, error) {
+	if t.FS == nil {
+		return filepath.Glob(pattern)
+	}
+	return fs.Glob(t.FS, pattern)
+}
+
+func (t *Theme) parse(tmpl *template.Template, files ...string) (*template.Template, error) {
+	if t.FS == nil {
+		return tmpl.ParseFiles(files...)
+	}
+	return tmpl.ParseFS(t.FS, files...)
+}
+
+// Static assets of the theme, nil if it has none
+func (t *Theme) Static() fs.FS {
+	if t.FS == nil {
+		return nil
+	}
+	if info, err := fs.Stat(t.FS, staticDirectory); err != nil || !info.IsDir() {
+		return nil
+	}
+	sub, err := fs.Sub(t.FS, staticDirectory)
+	if err != nil {
+		return nil
+	}
+	return sub
+}
+
+// Config values provided by the theme, overridden by the config file
+func (t *Theme) Defaults() (map[string]any, error) {
+	values := map[string]any{}
+	if t.FS == nil {
+		return values, nil
+	}
+
+	data, err := fs.ReadFile(t.FS, configFileName)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return values, nil
+		}
+		return nil, err
+	}
+	if err := toml.Unmarshal(data, &values); err != nil {
+		return nil, fmt.Errorf("failed to parse %s of theme %s (%v)", configFileName, t.Name, err)
+	}
+	return values, nil
+}
@@ -0,0 +1,90 @@
+package theme
+
+import (
+	"bytes"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/waynezhang/foto/internal/files"
+)
+
+func TestLoadBuiltIn(t *testing.T) {
+	theme, err := Load("default")
+	assert.Nil(t, err)
+	assert.Equal(t, "default", theme.Name)
+	assert.Empty(t, theme.Dir)
+
+	for _, name := range []string{"template.html", "index.html", "section.html"} {
+		_, err := theme.Template(name, nil)
+		assert.Nil(t, err, name)
+	}
+
+	_, err = fs.Stat(theme.Static(), "theme/style.css")
+	assert.Nil(t, err)
+
+	defaults, err := theme.Defaults()
+	assert.Nil(t, err)
+	assert.Equal(t, int64(4), defaults["layout"].(map[string]any)["maxColumn"])
+}
+
+func TestLoadFolder(t *testing.T) {
+	tmp := t.TempDir()
+	_ = files.WriteDataToFile([]byte(`{{ template "base" . }}{{ define "main" }}page{{ end }}`), filepath.Join(tmp, "template.html"))
+	_ = files.WriteDataToFile([]byte(`{{ define "base" }}<{{ template "header" }}{{ block "main" . }}layout{{ end }}>{{ end }}`), filepath.Join(tmp, "layouts", "base.html"))
+	_ = files.WriteDataToFile([]byte(`{{ define "header" }}header|{{ end }}`), filepath.Join(tmp, "partials", "header.html"))
+	_ = files.WriteDataToFile([]byte(`[site]`+"\n"+`title = "Theme"`), filepath.Join(tmp, "theme.toml"))
+
+	theme, err := Load(tmp)
+	assert.Nil(t, err)
+	assert.Equal(t, tmp, theme.Dir)
+	assert.Nil(t, theme.Static())
+
+	tmpl, err := theme.Template("template.html", nil)
+	assert.Nil(t, err)
+	buf := new(bytes.Buffer)
+	assert.Nil(t, tmpl.Execute(buf, nil))
+	assert.Equal(t, "&lt;header|page>", buf.String())
+
+	defaults, err := theme.Defaults()
+	assert.Nil(t, err)
+	assert.Equal(t, "Theme", defaults["site"].(map[string]any)["title"])
+}
+
+func TestLoadSite(t *testing.T) {
+	tmp := t.TempDir()
+	templatePath := filepath.Join(tmp, "templates", "template.html")
+	_ = files.WriteDataToFile([]byte(`{{ template "title" }}`), templatePath)
+	_ = files.WriteDataToFile([]byte(`{{ define "title" }}title{{ end }}`), filepath.Join(tmp, "templates", "partials", "title.html"))
+
+	theme, err := Load("")
+	assert.Nil(t, err)
+	assert.Nil(t, theme.Static())
+
+	tmpl, err := theme.Template(templatePath, nil)
+	assert.Nil(t, err)
+	buf := new(bytes.Buffer)
+	assert.Nil(t, tmpl.Execute(buf, nil))
+	assert.Equal(t, "title", buf.String())
+
+	defaults, err := theme.Defaults()
+	assert.Nil(t, err)
+	assert.Empty(t, defaults)
+}
+
+func TestLoadMissing(t *testing.T) {
+	_, err := Load("not-existing")
+	assert.NotNil(t, err)
+}
+
+func TestDefaultsInvalid(t *testing.T) {
+	tmp := t.TempDir()
+	_ = os.WriteFile(filepath.Join(tmp, "theme.toml"), []byte("invalid ="), 0644)
+
+	theme, err := Load(tmp)
+	assert.Nil(t, err)
+	_, err = theme.Defaults()
+	assert.NotNil(t, err)
+}
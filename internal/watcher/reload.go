@@ -0,0 +1,92 @@
+package watcher
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"sync"
+)
+
+// Pushes reload events to browsers through server-sent events
+type ReloadBroker struct {
+	mutex   sync.Mutex
+	clients map[chan struct{}]bool
+}
+
+func NewReloadBroker() *ReloadBroker {
+	return &ReloadBroker{
+		clients: map[chan struct{}]bool{},
+	}
+}
+
+// Ask every connected browser to reload
+func (b *ReloadBroker) Reload() {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	for ch := range b.clients {
+		select {
+		case ch <- struct{}{}:
+		default:
+			// a reload is already pending for this client
+		}
+	}
+}
+
+func (b *ReloadBroker) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "Streaming unsupported", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	flusher.Flush()
+
+	ch := b.subscribe()
+	defer b.unsubscribe(ch)
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-ch:
+			fmt.Fprint(w, "data: reload\n\n")
+			flusher.Flush()
+		}
+	}
+}
+
+func (b *ReloadBroker) subscribe() chan struct{} {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	ch := make(chan struct{}, 1)
+	b.clients[ch] = true
+	return ch
+}
+
+func (b *ReloadBroker) unsubscribe(ch chan struct{}) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	delete(b.clients, ch)
+}
+
+// Insert a script listening to `url` before the closing body tag of `html`
+func InjectReloadScript(html []byte, url string) []byte {
+	script := []byte(fmt.Sprintf(`<script>new EventSource("%s").onmessage = () => location.reload();</script>`, url))
+
+	idx := bytes.LastIndex(html, []byte("</body>"))
+	if idx < 0 {
+		return append(html, script...)
+	}
+
+	result := make([]byte, 0, len(html)+len(script))
+	result = append(result, html[:idx]...)
+	result = append(result, script...)
+	result = append(result, html[idx:]...)
+	return result
+}
@@ -0,0 +1,44 @@
+package watcher
+
+import (
+	"bufio"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestInjectReloadScript(t *testing.T) {
+	html := InjectReloadScript([]byte("<html><body>content</body></html>"), "/reload")
+	assert.Equal(t, `<html><body>content<script>new EventSource("/reload").onmessage = () => location.reload();</script></body></html>`, string(html))
+
+	// append when no body tag found
+	html = InjectReloadScript([]byte("content"), "/reload")
+	assert.Equal(t, `content<script>new EventSource("/reload").onmessage = () => location.reload();</script>`, string(html))
+}
+
+func TestReloadBroker(t *testing.T) {
+	broker := NewReloadBroker()
+	server := httptest.NewServer(broker)
+	defer server.Close()
+
+	resp, err := http.Get(server.URL)
+	assert.Nil(t, err)
+	defer resp.Body.Close()
+	assert.Equal(t, "text/event-stream", resp.Header.Get("Content-Type"))
+
+	// wait for the client to be subscribed
+	assert.Eventually(t, func() bool {
+		broker.mutex.Lock()
+		defer broker.mutex.Unlock()
+		return len(broker.clients) == 1
+	}, time.Second, 10*time.Millisecond)
+
+	broker.Reload()
+
+	line, err := bufio.NewReader(resp.Body).ReadString('\n')
+	assert.Nil(t, err)
+	assert.Equal(t, "data: reload\n", line)
+}
@@ -0,0 +1,146 @@
+package watcher
+
+import (
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/rs/zerolog/log"
+)
+
+const debounceInterval = 300 * time.Millisecond
+
+// Watches files and folders recursively, calling `onChange` once per burst of events
+type Watcher struct {
+	fsw      *fsnotify.Watcher
+	onChange func()
+	mutex    sync.Mutex
+	timer    *time.Timer
+	done     chan struct{}
+
+	// Folders watched for their own sake, and single files watched through their parent folder
+	folders map[string]bool
+	files   map[string]bool
+}
+
+func New(onChange func()) (*Watcher, error) {
+	fsw, err := fsnotify.NewWatcher()
+	if err != nil {
+		return nil, err
+	}
+
+	w := &Watcher{
+		fsw:      fsw,
+		onChange: onChange,
+		done:     make(chan struct{}),
+	}
+	go w.loop()
+
+	return w, nil
+}
+
+// Replace all watched paths with `paths`. Folders are watched with all their sub folders.
+func (w *Watcher) Reset(paths []string) {
+	w.mutex.Lock()
+	w.folders = map[string]bool{}
+	w.files = map[string]bool{}
+	w.mutex.Unlock()
+
+	for _, path := range w.fsw.WatchList() {
+		_ = w.fsw.Remove(path)
+	}
+
+	for _, path := range paths {
+		w.add(path)
+	}
+}
+
+func (w *Watcher) Close() error {
+	close(w.done)
+	return w.fsw.Close()
+}
+
+func (w *Watcher) add(path string) {
+	info, err := os.Stat(path)
+	if err != nil {
+		log.Warn().Msgf("Failed to watch %s (%v)", path, err)
+		return
+	}
+
+	if !info.IsDir() {
+		// Watch the parent so editors that replace the file on save are still detected
+		w.mutex.Lock()
+		w.files[filepath.Clean(path)] = true
+		w.mutex.Unlock()
+		w.addFolder(filepath.Dir(path))
+		return
+	}
+
+	_ = filepath.WalkDir(path, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return nil
+		}
+		if d.IsDir() {
+			w.mutex.Lock()
+			w.folders[filepath.Clean(p)] = true
+			w.mutex.Unlock()
+			w.addFolder(p)
+		}
+		return nil
+	})
+}
+
+func (w *Watcher) isWatched(path string) bool {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	path = filepath.Clean(path)
+	return w.files[path] || w.folders[path] || w.folders[filepath.Dir(path)]
+}
+
+func (w *Watcher) addFolder(path string) {
+	if err := w.fsw.Add(path); err != nil {
+		log.Warn().Msgf("Failed to watch %s (%v)", path, err)
+	}
+}
+
+func (w *Watcher) loop() {
+	for {
+		select {
+		case <-w.done:
+			return
+		case event, ok := <-w.fsw.Events:
+			if !ok {
+				return
+			}
+			if !w.isWatched(event.Name) {
+				continue
+			}
+			log.Debug().Msgf("File changed %s", event)
+			if event.Has(fsnotify.Create) {
+				if info, err := os.Stat(event.Name); err == nil && info.IsDir() {
+					w.add(event.Name)
+				}
+			}
+			w.trigger()
+		case err, ok := <-w.fsw.Errors:
+			if !ok {
+				return
+			}
+			log.Warn().Msgf("Failed to watch files (%v)", err)
+		}
+	}
+}
+
+func (w *Watcher) trigger() {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	if w.timer != nil {
+		w.timer.Stop()
+	}
+	w.timer = time.AfterFunc(debounceInterval, w.onChange)
+}
@@ -0,0 +1,51 @@
+package watcher
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/waynezhang/foto/internal/files"
+)
+
+func TestWatcher(t *testing.T) {
+	tmp, err := os.MkdirTemp("", "foto-test")
+	assert.Nil(t, err)
+	defer os.RemoveAll(tmp)
+
+	folder := filepath.Join(tmp, "folder", "sub")
+	file := filepath.Join(tmp, "foto.toml")
+	_ = files.EnsureDirectory(folder)
+	_ = files.WriteDataToFile([]byte("config"), file)
+
+	changed := make(chan struct{}, 10)
+	w, err := New(func() {
+		changed <- struct{}{}
+	})
+	assert.Nil(t, err)
+	defer w.Close()
+
+	w.Reset([]string{file, filepath.Join(tmp, "folder")})
+
+	// unrelated files next to a watched file are ignored
+	_ = files.WriteDataToFile([]byte("other"), filepath.Join(tmp, "other.txt"))
+	assert.False(t, waitForChange(changed))
+
+	_ = files.WriteDataToFile([]byte("new config"), file)
+	assert.True(t, waitForChange(changed))
+
+	// sub folders are watched as well
+	_ = files.WriteDataToFile([]byte("photo"), filepath.Join(folder, "photo.jpg"))
+	assert.True(t, waitForChange(changed))
+}
+
+func waitForChange(changed chan struct{}) bool {
+	select {
+	case <-changed:
+		return true
+	case <-time.After(3 * debounceInterval):
+		return false
+	}
+}
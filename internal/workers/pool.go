@@ -0,0 +1,105 @@
+package workers
+
+import (
+	"context"
+	"math"
+	"runtime"
+	"runtime/debug"
+	"sync"
+
+	"golang.org/x/sync/semaphore"
+)
+
+// Memory for decoded images when `GOMEMLIMIT` is not set
+const defaultMemoryLimit int64 = 1 << 30
+
+var (
+	// Number of jobs run at a time. Set by `--jobs`.
+	Jobs = runtime.NumCPU()
+
+	once     sync.Once
+	instance *Pool
+)
+
+// Pool runs at most `jobs` jobs at a time, and only as many as the memory they need fits in the limit
+type Pool struct {
+	jobs        *semaphore.Weighted
+	memory      *semaphore.Weighted
+	memoryLimit int64
+}
+
+// Pool shared by indexing, export and preview
+func Shared() *Pool {
+	once.Do(func() {
+		instance = New(Jobs, MemoryLimit())
+	})
+	return instance
+}
+
+func New(jobs int, memoryLimit int64) *Pool {
+	jobs = max(jobs, 1)
+	return &Pool{
+		jobs:        semaphore.NewWeighted(int64(jobs)),
+		memory:      semaphore.NewWeighted(memoryLimit),
+		memoryLimit: memoryLimit,
+	}
+}
+
+// Half of `GOMEMLIMIT` when set, leaving the rest to encoded images and everything else
+func MemoryLimit() int64 {
+	if limit := debug.SetMemoryLimit(-1); limit != math.MaxInt64 {
+		return max(limit/2, 1)
+	}
+	return defaultMemoryLimit
+}
+
+// Runs `fn` once a job and `memory` bytes are available, blocking until it returns
+func (p *Pool) Run(memory int64, fn func()) {
+	memory = p.acquire(memory)
+	defer p.release(memory)
+
+	fn()
+}
+
+func (p *Pool) acquire(memory int64) int64 {
+	// Images larger than the limit wait for the others to finish and run alone
+	memory = min(max(memory, 0), p.memoryLimit)
+
+	_ = p.jobs.Acquire(context.Background(), 1)
+	_ = p.memory.Acquire(context.Background(), memory)
+	return memory
+}
+
+func (p *Pool) release(memory int64) {
+	p.memory.Release(memory)
+	p.jobs.Release(1)
+}
+
+// Jobs started together in a pool and waited for together
+type Group struct {
+	pool *Pool
+	wg   sync.WaitGroup
+}
+
+func (p *Pool) Group() *Group {
+	return &Group{pool: p}
+}
+
+// Runs `fn` in a goroutine once a job and `memory` bytes are available, blocking until then
+// so no more goroutines than jobs are started
+func (g *Group) Go(memory int64, fn func()) {
+	memory = g.pool.acquire(memory)
+
+	g.wg.Add(1)
+	go func() {
+		defer g.wg.Done()
+		defer g.pool.release(memory)
+
+		fn()
+	}()
+}
+
+// Waits for all jobs started by `Go`
+func (g *Group) Wait() {
+	g.wg.Wait()
+}
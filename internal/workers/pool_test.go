@@ -0,0 +1,73 @@
+package workers
+
+import (
+	"math"
+	"runtime/debug"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// Runs `count` jobs of `memory` bytes and returns the most run at a time
+func maxConcurrency(p *Pool, count int, memory int64) int32 {
+	var running, most atomic.Int32
+	g := p.Group()
+	for range count {
+		g.Go(memory, func() {
+			n := running.Add(1)
+			for {
+				m := most.Load()
+				if n <= m || most.CompareAndSwap(m, n) {
+					break
+				}
+			}
+			time.Sleep(5 * time.Millisecond)
+			running.Add(-1)
+		})
+	}
+	g.Wait()
+	return most.Load()
+}
+
+func TestPoolJobs(t *testing.T) {
+	assert.Equal(t, int32(2), maxConcurrency(New(2, 100), 10, 1))
+	assert.Equal(t, int32(1), maxConcurrency(New(0, 100), 5, 1))
+}
+
+func TestPoolMemory(t *testing.T) {
+	assert.Equal(t, int32(2), maxConcurrency(New(8, 100), 10, 50))
+
+	// Larger than the limit, run one by one
+	assert.Equal(t, int32(1), maxConcurrency(New(8, 100), 3, 500))
+}
+
+func TestPoolRun(t *testing.T) {
+	p := New(1, 100)
+	wg := sync.WaitGroup{}
+	var running, most atomic.Int32
+	for range 4 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			p.Run(10, func() {
+				most.Store(max(most.Load(), running.Add(1)))
+				time.Sleep(5 * time.Millisecond)
+				running.Add(-1)
+			})
+		}()
+	}
+	wg.Wait()
+	assert.Equal(t, int32(1), most.Load())
+}
+
+func TestMemoryLimit(t *testing.T) {
+	previous := debug.SetMemoryLimit(math.MaxInt64)
+	defer debug.SetMemoryLimit(previous)
+	assert.Equal(t, defaultMemoryLimit, MemoryLimit())
+
+	debug.SetMemoryLimit(4 << 30)
+	assert.Equal(t, int64(2<<30), MemoryLimit())
+}